@@ -0,0 +1,103 @@
+package df_pv
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PVC annotations overriding the configured thresholds, or excluding the volume from severity checks
+const (
+	WarnPercentAnnotation          = "df-pv.io/warn-percent"
+	CriticalPercentAnnotation      = "df-pv.io/critical-percent"
+	InodeWarnPercentAnnotation     = "df-pv.io/inode-warn-percent"
+	InodeCriticalPercentAnnotation = "df-pv.io/inode-critical-percent"
+	IgnoreAnnotation               = "df-pv.io/ignore"
+)
+
+// ThresholdOverrides holds the thresholds set by annotations on a PVC; nil fields keep the configured thresholds
+type ThresholdOverrides struct {
+	Warn          *float64 `json:"warn,omitempty"`
+	Critical      *float64 `json:"critical,omitempty"`
+	InodeWarn     *float64 `json:"inodeWarn,omitempty"`
+	InodeCritical *float64 `json:"inodeCritical,omitempty"`
+}
+
+// ParseVolumeAnnotations reads the threshold overrides and the ignore flag from the annotations of a PVC;
+// malformed values are logged and skipped so that one bad annotation does not fail the whole node
+func ParseVolumeAnnotations(pvcKey string, annotations map[string]string) (*ThresholdOverrides, bool) {
+	var ignore bool
+	if value, ok := annotations[IgnoreAnnotation]; ok {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			log.Warnf("ignoring annotation %s=%q on PVC %s: not a boolean", IgnoreAnnotation, value, pvcKey)
+		}
+		ignore = parsed
+	}
+
+	overrides := &ThresholdOverrides{
+		Warn:          parsePercentAnnotation(pvcKey, annotations, WarnPercentAnnotation),
+		Critical:      parsePercentAnnotation(pvcKey, annotations, CriticalPercentAnnotation),
+		InodeWarn:     parsePercentAnnotation(pvcKey, annotations, InodeWarnPercentAnnotation),
+		InodeCritical: parsePercentAnnotation(pvcKey, annotations, InodeCriticalPercentAnnotation),
+	}
+	if overrides.Warn == nil && overrides.Critical == nil && overrides.InodeWarn == nil && overrides.InodeCritical == nil {
+		return nil, ignore
+	}
+	return overrides, ignore
+}
+
+func parsePercentAnnotation(pvcKey string, annotations map[string]string, annotation string) *float64 {
+	value, ok := annotations[annotation]
+	if !ok {
+		return nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		log.Warnf("ignoring annotation %s=%q on PVC %s: not a percentage between 0 and 100", annotation, value, pvcKey)
+		return nil
+	}
+	return &percent
+}
+
+// Apply returns the thresholds with the overrides applied; overrides that would put a warn threshold above its
+// critical threshold are not applied
+func (o *ThresholdOverrides) Apply(thresholds Thresholds) Thresholds {
+	if o == nil {
+		return thresholds
+	}
+	return Thresholds{
+		Bytes:  applyThresholdOverride(thresholds.Bytes, o.Warn, o.Critical),
+		Inodes: applyThresholdOverride(thresholds.Inodes, o.InodeWarn, o.InodeCritical),
+	}
+}
+
+func applyThresholdOverride(threshold Threshold, warn *float64, critical *float64) Threshold {
+	overridden := threshold
+	if warn != nil {
+		overridden.Warn = *warn
+	}
+	if critical != nil {
+		overridden.Critical = *critical
+	}
+	if err := overridden.validate(); err != nil {
+		log.Debugf("not applying threshold annotations: %v", err)
+		return threshold
+	}
+	return overridden
+}
+
+// EffectiveThresholds returns the thresholds that apply to the row, i.e. the given ones with the row's
+// annotation overrides applied
+func (row *OutputRowPVC) EffectiveThresholds(thresholds Thresholds) Thresholds {
+	return row.ThresholdOverrides.Apply(thresholds)
+}
+
+// dropAnnotations discards what was read from PVC annotations, for --ignore-annotations
+func dropAnnotations(sliceOfOutputRowPVC []*OutputRowPVC) {
+	for _, row := range sliceOfOutputRowPVC {
+		row.ThresholdOverrides = nil
+		row.Ignored = false
+	}
+}
@@ -0,0 +1,106 @@
+package df_pv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jedib0t/go-pretty/text"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestParseVolumeAnnotations(t *testing.T) {
+	overrides, ignore := ParseVolumeAnnotations("ns/pvc", map[string]string{
+		WarnPercentAnnotation:          "60",
+		CriticalPercentAnnotation:      "95%",
+		InodeCriticalPercentAnnotation: "lots",
+		IgnoreAnnotation:               "true",
+	})
+	if !ignore {
+		t.Fatal("expected the ignore annotation to be read")
+	}
+	if overrides == nil || *overrides.Warn != 60 || *overrides.Critical != 95 || overrides.InodeWarn != nil || overrides.InodeCritical != nil {
+		t.Fatalf("unexpected overrides: %+v", overrides)
+	}
+
+	if overrides, ignore := ParseVolumeAnnotations("ns/pvc", map[string]string{"other": "1", WarnPercentAnnotation: "150"}); overrides != nil || ignore {
+		t.Fatalf("expected no overrides for out of range values, got %+v, ignore=%t", overrides, ignore)
+	}
+}
+
+func TestThresholdOverridesApply(t *testing.T) {
+	thresholds := Thresholds{Bytes: Threshold{Warn: 25, Critical: 75}, Inodes: Threshold{Warn: 25, Critical: 75}}
+
+	got := (&ThresholdOverrides{Critical: float64Ptr(95), InodeWarn: float64Ptr(50)}).Apply(thresholds)
+	want := Thresholds{Bytes: Threshold{Warn: 25, Critical: 95}, Inodes: Threshold{Warn: 50, Critical: 75}}
+	if got != want {
+		t.Fatalf("Apply = %+v, want %+v", got, want)
+	}
+
+	// a warn override above the configured critical threshold is inconsistent and not applied
+	if got := (&ThresholdOverrides{Warn: float64Ptr(90)}).Apply(thresholds); got != thresholds {
+		t.Fatalf("Apply with an inconsistent override = %+v, want unchanged %+v", got, thresholds)
+	}
+	if got := (*ThresholdOverrides)(nil).Apply(thresholds); got != thresholds {
+		t.Fatalf("nil Apply = %+v, want unchanged %+v", got, thresholds)
+	}
+}
+
+func TestAnnotationsApplyToFilteringAndChecks(t *testing.T) {
+	thresholds := Thresholds{Bytes: Threshold{Warn: 25, Critical: 75}, Inodes: Threshold{Warn: 25, Critical: 75}}
+	relaxed := &OutputRowPVC{PVCName: "relaxed", PercentageUsed: 80, ThresholdOverrides: &ThresholdOverrides{Critical: float64Ptr(90)}}
+	ignored := &OutputRowPVC{PVCName: "ignored", PercentageUsed: 99, Ignored: true}
+	plain := &OutputRowPVC{PVCName: "plain", PercentageUsed: 80}
+
+	if relaxed.EffectiveThresholds(thresholds).Bytes.Color(relaxed.PercentageUsed) != text.FgYellow {
+		t.Fatal("expected the annotated critical threshold to keep the volume yellow")
+	}
+
+	filter, err := NewRowFilter("red", 0, 100, thresholds)
+	if err != nil {
+		t.Fatalf("NewRowFilter returned unexpected error: %v", err)
+	}
+	if got := pvcNames(FilterOutputRows([]*OutputRowPVC{relaxed, ignored, plain}, filter)); len(got) != 1 || got[0] != "plain" {
+		t.Fatalf("FilterOutputRows(red) = %v, want [plain]", got)
+	}
+
+	filter, err = NewRowFilter("", 50, 100, thresholds)
+	if err != nil {
+		t.Fatalf("NewRowFilter returned unexpected error: %v", err)
+	}
+	if got := pvcNames(FilterOutputRows([]*OutputRowPVC{relaxed, ignored, plain}, filter)); len(got) != 2 || got[0] != "relaxed" || got[1] != "plain" {
+		t.Fatalf("FilterOutputRows(min-used 50) = %v, want [relaxed plain]", got)
+	}
+
+	results := CheckOutputRows([]*OutputRowPVC{relaxed, ignored, plain}, Thresholds{Bytes: Threshold{Warn: 70, Critical: 75}, Inodes: thresholds.Inodes})
+	if len(results) != 2 {
+		t.Fatalf("expected the ignored volume to be skipped, got %d results", len(results))
+	}
+	if results[0].State != CheckStateWarning || results[1].State != CheckStateCritical {
+		t.Fatalf("unexpected states: relaxed=%s plain=%s", results[0].State, results[1].State)
+	}
+}
+
+func TestGetOutputRowPVCFromPodAndVolumeReadsAnnotations(t *testing.T) {
+	pvc := newBoundPVC("ns", "pvc-a", "pv-a")
+	pvc.Annotations = map[string]string{IgnoreAnnotation: "true", WarnPercentAnnotation: "50"}
+	clientset := newFakeClusterClientset(t, &fakeCluster{pvcs: []corev1.PersistentVolumeClaim{pvc}})
+
+	pod := &Pod{}
+	pod.PodRef.Name = "pod-a"
+	pod.PodRef.Namespace = "ns"
+	vol := &Volume{Name: "data", CapacityBytes: 100, UsedBytes: 10}
+	vol.PvcRef.PvcName = "pvc-a"
+	vol.PvcRef.PvcNamespace = "ns"
+
+	row, err := GetOutputRowPVCFromPodAndVolume(context.Background(), NewVolumeClaimIndex(clientset, ""), pod, vol, nil)
+	if err != nil {
+		t.Fatalf("GetOutputRowPVCFromPodAndVolume returned unexpected error: %v", err)
+	}
+	if !row.Ignored || row.ThresholdOverrides == nil || *row.ThresholdOverrides.Warn != 50 {
+		t.Fatalf("annotations were not read into the row: %+v", row)
+	}
+}
@@ -0,0 +1,266 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// CheckState is the outcome of a check, using the nagios plugin exit codes
+type CheckState int
+
+// Nagios plugin return codes, see https://nagios-plugins.org/doc/guidelines.html#AEN78
+const (
+	CheckStateOK       CheckState = 0
+	CheckStateWarning  CheckState = 1
+	CheckStateCritical CheckState = 2
+	CheckStateUnknown  CheckState = 3
+)
+
+func (s CheckState) String() string {
+	switch s {
+	case CheckStateOK:
+		return "OK"
+	case CheckStateWarning:
+		return "WARNING"
+	case CheckStateCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// CheckResult is the state of one volume along with why it is not OK
+type CheckResult struct {
+	Row     *OutputRowPVC
+	State   CheckState
+	Reasons []string
+}
+
+// checkPercentage returns the state of a usage percentage: critical from Critical on, warning from Warn on; both
+// limits are inclusive, whereas the table only turns red above the critical threshold. A percentage that cannot be
+// computed (e.g. a volume that does not report inodes) is OK
+func checkPercentage(percentageUsed float64, limit Threshold) CheckState {
+	if math.IsNaN(percentageUsed) || math.IsInf(percentageUsed, 0) {
+		return CheckStateOK
+	}
+	if percentageUsed >= limit.Critical {
+		return CheckStateCritical
+	}
+	if percentageUsed >= limit.Warn {
+		return CheckStateWarning
+	}
+	return CheckStateOK
+}
+
+// CheckOutputRow evaluates the byte and inode usage of a row against the limits, overridden by its annotations
+func CheckOutputRow(row *OutputRowPVC, limits Thresholds) *CheckResult {
+	result := &CheckResult{Row: row, State: CheckStateOK}
+	limits = row.EffectiveThresholds(limits)
+	if state := checkPercentage(row.PercentageUsed, limits.Bytes); state != CheckStateOK {
+		result.State = state
+		result.Reasons = append(result.Reasons, fmt.Sprintf("%.1f%% used (%s)", row.PercentageUsed, describeLimit(state, limits.Bytes)))
+	}
+	if state := checkPercentage(row.PercentageIUsed, limits.Inodes); state != CheckStateOK {
+		if state > result.State {
+			result.State = state
+		}
+		result.Reasons = append(result.Reasons, fmt.Sprintf("%.1f%% inodes used (%s)", row.PercentageIUsed, describeLimit(state, limits.Inodes)))
+	}
+	return result
+}
+
+// describeLimit tells which limit a usage percentage reached, e.g. "warning at or above 80%"
+func describeLimit(state CheckState, limit Threshold) string {
+	if state == CheckStateCritical {
+		return fmt.Sprintf("critical at or above %v%%", limit.Critical)
+	}
+	return fmt.Sprintf("warning at or above %v%%", limit.Warn)
+}
+
+// CheckOutputRows evaluates every row that is not ignored against the limits
+func CheckOutputRows(sliceOfOutputRowPVC []*OutputRowPVC, limits Thresholds) []*CheckResult {
+	results := make([]*CheckResult, 0, len(sliceOfOutputRowPVC))
+	for _, row := range sliceOfOutputRowPVC {
+		if row.Ignored {
+			continue
+		}
+		results = append(results, CheckOutputRow(row, limits))
+	}
+	return results
+}
+
+// PrintCheckResults prints a nagios plugin output: a one-line status summary with perfdata, followed by one line
+// per offending volume; it returns the overall state
+func PrintCheckResults(w io.Writer, results []*CheckResult, nodeCollectionErr *NodeCollectionError, limits Thresholds) (CheckState, error) {
+	state := CheckStateOK
+	counts := make(map[CheckState]int)
+	for _, result := range results {
+		counts[result.State]++
+		if result.State > state {
+			state = result.State
+		}
+	}
+	// volumes on failed nodes were not checked, so only a critical volume is more important than that
+	if nodeCollectionErr != nil && state < CheckStateCritical {
+		state = CheckStateUnknown
+	}
+
+	summary := fmt.Sprintf("%d critical, %d warning of %d volumes", counts[CheckStateCritical], counts[CheckStateWarning], len(results))
+	if nodeCollectionErr != nil {
+		summary = fmt.Sprintf("%s; failed to query %d of %d nodes", summary, len(nodeCollectionErr.FailedNodes), nodeCollectionErr.TotalNodes)
+	}
+	if _, err := fmt.Fprintf(w, "DF-PV %s - %s | %s\n", state, summary, checkPerfData(results, limits)); err != nil {
+		return state, err
+	}
+
+	for _, wantState := range []CheckState{CheckStateCritical, CheckStateWarning} {
+		for _, result := range results {
+			if result.State != wantState {
+				continue
+			}
+			row := result.Row
+			if _, err := fmt.Fprintf(w, "%s %s/%s: %s (pv '%s', pod '%s', node '%s')\n", result.State, row.Namespace, row.PVCName, strings.Join(result.Reasons, ", "), row.PVName, row.PodName, row.NodeName); err != nil {
+				return state, err
+			}
+		}
+	}
+	if nodeCollectionErr != nil {
+		for _, failed := range nodeCollectionErr.FailedNodes {
+			if _, err := fmt.Fprintf(w, "%s node '%s': %s (%s)\n", CheckStateUnknown, failed.NodeName, failed.Message, failed.Class); err != nil {
+				return state, err
+			}
+		}
+	}
+	return state, nil
+}
+
+// checkPerfData formats the usage of every volume as nagios performance data; a PVC mounted by several pods is
+// only reported once
+func checkPerfData(results []*CheckResult, limits Thresholds) string {
+	var perfData []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		row := result.Row
+		key := pvcKey(row.Namespace, row.PVCName)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rowLimits := row.EffectiveThresholds(limits)
+		perfData = append(perfData, formatPerfData(key, row.PercentageUsed, rowLimits.Bytes))
+		if !math.IsNaN(row.PercentageIUsed) && !math.IsInf(row.PercentageIUsed, 0) {
+			perfData = append(perfData, formatPerfData(key+" inodes", row.PercentageIUsed, rowLimits.Inodes))
+		}
+	}
+	return strings.Join(perfData, " ")
+}
+
+// formatPerfData formats one nagios performance data item: 'label'=value%;warn;crit;min;max
+func formatPerfData(label string, percentageUsed float64, limit Threshold) string {
+	if math.IsNaN(percentageUsed) || math.IsInf(percentageUsed, 0) {
+		return fmt.Sprintf("'%s'=U;%v;%v;0;100", strings.ReplaceAll(label, "'", "''"), limit.Warn, limit.Critical)
+	}
+	return fmt.Sprintf("'%s'=%.2f%%;%v;%v;0;100", strings.ReplaceAll(label, "'", "''"), percentageUsed, limit.Warn, limit.Critical)
+}
+
+func setupCheckCommand(flags *flagpole) *cobra.Command {
+	var checkCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Check volume usage against limits, nagios plugin style",
+		Long: `check evaluates every volume against the limits and prints only the offending ones
+
+The first line is a nagios compatible status summary followed by perfdata; the exit code is
+0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN, e.g. when the volume stats or some nodes could not be queried)
+
+A volume is WARNING when its %used is at or above --warn-above (or its %iused at or above --inode-warn-above),
+and CRITICAL when at or above --fail-above (or --inode-fail-above)`,
+		Args:          cobra.MaximumNArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheck(flags)
+		},
+	}
+
+	checkCmd.Flags().Float64Var(&flags.warnAbove, "warn-above", 80, "%used at or above which a volume is WARNING")
+	checkCmd.Flags().Float64Var(&flags.failAbove, "fail-above", 90, "%used at or above which a volume is CRITICAL")
+	checkCmd.Flags().Float64Var(&flags.inodeWarnAbove, "inode-warn-above", 80, "%iused at or above which a volume is WARNING")
+	checkCmd.Flags().Float64Var(&flags.inodeFailAbove, "inode-fail-above", 95, "%iused at or above which a volume is CRITICAL")
+	addCollectionFlags(checkCmd.Flags(), flags)
+	addAnnotationFlags(checkCmd.Flags(), flags)
+	addSourceFlags(checkCmd.Flags(), flags)
+
+	return checkCmd
+}
+
+// parseCheck validates the flags of the check command before any kubernetes access
+func (flags *flagpole) parseCheck() (Thresholds, error) {
+	limits, err := NewThresholds(flags.warnAbove, flags.failAbove, flags.inodeWarnAbove, flags.inodeFailAbove)
+	if err != nil {
+		return Thresholds{}, errors.Wrap(err, "invalid limits")
+	}
+	if _, err := flags.namespaceFilter(); err != nil {
+		return Thresholds{}, errors.Wrap(err, "invalid namespace selection")
+	}
+	if err := flags.validateSource(); err != nil {
+		return Thresholds{}, err
+	}
+	// check has none of the --probe-* flags
+	if source, _ := flags.selectedSource(); source == sourceProbe {
+		return Thresholds{}, fmt.Errorf("the %s source is not supported by check", sourceProbe)
+	}
+	if err := flags.nodeQueryOptions().validate(); err != nil {
+		return Thresholds{}, errors.Wrap(err, "invalid node query options")
+	}
+	_, err = GetRequestTimeoutFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	return limits, err
+}
+
+// unknownCheckError prints the UNKNOWN status line for an error that prevented the check
+func unknownCheckError(w io.Writer, err error) error {
+	fmt.Fprintf(w, "DF-PV %s - %v\n", CheckStateUnknown, err)
+	return &ExitCodeError{Code: int(CheckStateUnknown), Err: err}
+}
+
+func runCheck(flags *flagpole) error {
+	limits, err := flags.parseCheck()
+	if err != nil {
+		return unknownCheckError(os.Stdout, err)
+	}
+
+	logLevel, _ := log.ParseLevel(flags.logLevel)
+	log.SetLevel(logLevel)
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+
+	sliceOfOutputRowPVC, err := GetSliceOfOutputRowPVC(context.Background(), flags)
+	var nodeCollectionErr *NodeCollectionError
+	if errors.As(err, &nodeCollectionErr) {
+		if !nodeCollectionErr.IsPartial() {
+			return unknownCheckError(os.Stdout, err)
+		}
+	} else if err != nil {
+		return unknownCheckError(os.Stdout, errors.Wrap(err, "failed to collect volume stats"))
+	}
+
+	sliceOfOutputRowPVC = DeduplicateOutputRows(sliceOfOutputRowPVC)
+	SortOutputRows(sliceOfOutputRowPVC, defaultSortOrder, false)
+	state, err := PrintCheckResults(os.Stdout, CheckOutputRows(sliceOfOutputRowPVC, limits), nodeCollectionErr, limits)
+	if err != nil {
+		log.Errorf("error printing check results: %v", err)
+		return &ExitCodeError{Code: int(CheckStateUnknown), Err: errors.Wrap(err, "error printing check results")}
+	}
+	if state != CheckStateOK {
+		return &ExitCodeError{Code: int(state)}
+	}
+	return nil
+}
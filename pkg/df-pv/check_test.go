@@ -0,0 +1,111 @@
+package df_pv
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputRow(t *testing.T) {
+	limits := Thresholds{Bytes: Threshold{Warn: 80, Critical: 90}, Inodes: Threshold{Warn: 80, Critical: 95}}
+	tests := []struct {
+		name  string
+		row   *OutputRowPVC
+		want  CheckState
+		cause string
+	}{
+		{name: "below limits", row: newTestRow("ns", "ok", 100, 50), want: CheckStateOK},
+		{name: "at warn limit is a warning", row: newTestRow("ns", "edge", 100, 80), want: CheckStateWarning, cause: "80.0% used (warning at or above 80%)"},
+		{name: "at critical limit is critical", row: newTestRow("ns", "edge", 100, 90), want: CheckStateCritical, cause: "90.0% used (critical at or above 90%)"},
+		{name: "bytes warning", row: newTestRow("ns", "warn", 100, 85), want: CheckStateWarning, cause: "85.0% used (warning at or above 80%)"},
+		{name: "inodes critical wins", row: withPercentageIUsed(newTestRow("ns", "crit", 100, 85), 96), want: CheckStateCritical, cause: "96.0% inodes used (critical at or above 95%)"},
+		{name: "no inodes reported", row: withPercentageIUsed(newTestRow("ns", "nan", 100, 10), math.NaN()), want: CheckStateOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CheckOutputRow(tt.row, limits)
+			if result.State != tt.want {
+				t.Fatalf("CheckOutputRow state = %s, want %s", result.State, tt.want)
+			}
+			if tt.cause != "" && !strings.Contains(strings.Join(result.Reasons, ", "), tt.cause) {
+				t.Fatalf("CheckOutputRow reasons = %v, missing %q", result.Reasons, tt.cause)
+			}
+		})
+	}
+}
+
+func TestCheckOutputRowWithEqualLimits(t *testing.T) {
+	limits := Thresholds{Bytes: Threshold{Warn: 90, Critical: 90}, Inodes: Threshold{Warn: 90, Critical: 90}}
+	tests := []struct {
+		usedBytes int64
+		want      CheckState
+	}{
+		{usedBytes: 89, want: CheckStateOK},
+		{usedBytes: 90, want: CheckStateCritical},
+		{usedBytes: 91, want: CheckStateCritical},
+	}
+
+	for _, tt := range tests {
+		if got := CheckOutputRow(newTestRow("ns", "edge", 100, tt.usedBytes), limits).State; got != tt.want {
+			t.Fatalf("CheckOutputRow(%d%% used) with --warn-above 90 --fail-above 90 = %s, want %s", tt.usedBytes, got, tt.want)
+		}
+	}
+}
+
+func TestPrintCheckResults(t *testing.T) {
+	limits := Thresholds{Bytes: Threshold{Warn: 80, Critical: 90}, Inodes: Threshold{Warn: 80, Critical: 95}}
+	rows := []*OutputRowPVC{
+		newTestRow("ns", "ok", 1000, 125),
+		newTestRow("ns", "warn", 100, 85),
+	}
+	rows[1].PVName, rows[1].PodName, rows[1].NodeName = "pv-warn", "db-0", "node-1"
+
+	var buf bytes.Buffer
+	state, err := PrintCheckResults(&buf, CheckOutputRows(rows, limits), nil, limits)
+	if err != nil {
+		t.Fatalf("PrintCheckResults returned unexpected error: %v", err)
+	}
+	if state != CheckStateWarning {
+		t.Fatalf("PrintCheckResults state = %s, want WARNING", state)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	wantStatus := "DF-PV WARNING - 0 critical, 1 warning of 2 volumes | 'ns/ok'=12.50%;80;90;0;100 'ns/ok inodes'=10.00%;80;95;0;100 'ns/warn'=85.00%;80;90;0;100 'ns/warn inodes'=10.00%;80;95;0;100"
+	if lines[0] != wantStatus {
+		t.Fatalf("status line = %q, want %q", lines[0], wantStatus)
+	}
+	if len(lines) != 2 || lines[1] != "WARNING ns/warn: 85.0% used (warning at or above 80%) (pv 'pv-warn', pod 'db-0', node 'node-1')" {
+		t.Fatalf("expected only the offending volume to be listed, got %q", lines[1:])
+	}
+}
+
+func TestPrintCheckResultsIsUnknownWhenNodesFailedUnlessCritical(t *testing.T) {
+	limits := Thresholds{Bytes: Threshold{Warn: 80, Critical: 90}, Inodes: Threshold{Warn: 80, Critical: 95}}
+	collectionErr := &NodeCollectionError{
+		FailedNodes: []*NodeError{{NodeName: "node-b", Class: nodeErrorClassTimeout, Message: "deadline exceeded"}},
+		TotalNodes:  2,
+	}
+
+	var buf bytes.Buffer
+	state, _ := PrintCheckResults(&buf, CheckOutputRows([]*OutputRowPVC{newTestRow("ns", "warn", 100, 85)}, limits), collectionErr, limits)
+	if state != CheckStateUnknown {
+		t.Fatalf("state with failed nodes = %s, want UNKNOWN", state)
+	}
+	if !strings.Contains(buf.String(), "failed to query 1 of 2 nodes") || !strings.Contains(buf.String(), "UNKNOWN node 'node-b'") {
+		t.Fatalf("output does not report the failed node: %q", buf.String())
+	}
+
+	state, _ = PrintCheckResults(&buf, CheckOutputRows([]*OutputRowPVC{newTestRow("ns", "crit", 100, 99)}, limits), collectionErr, limits)
+	if state != CheckStateCritical {
+		t.Fatalf("state with failed nodes and a critical volume = %s, want CRITICAL", state)
+	}
+}
+
+func TestRunCheckRejectsInvalidLimitsAsUnknown(t *testing.T) {
+	err := runCheck(&flagpole{warnAbove: 95, failAbove: 90})
+	exitCodeErr, ok := err.(*ExitCodeError)
+	if !ok || exitCodeErr.Code != int(CheckStateUnknown) {
+		t.Fatalf("runCheck error = %v, want exit code %d", err, CheckStateUnknown)
+	}
+}
@@ -0,0 +1,254 @@
+package df_pv
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+// VolumeClaimIndex indexes PVCs by namespace/name and PVs by name so that every node producer
+// can resolve claims without issuing an API call per volume; it is loaded lazily with one list call each
+type VolumeClaimIndex struct {
+	clientset kubernetes.Interface
+	namespace string
+
+	once    sync.Once
+	loadErr error
+	pvsErr  error
+	pvs     map[string]*corev1.PersistentVolume
+	// mu guards pvcs and missingPVCs, which grow after loading as claims not listed are fetched one by one
+	mu          sync.RWMutex
+	pvcs        map[string]*corev1.PersistentVolumeClaim
+	missingPVCs map[string]bool
+	// withoutClaims is set when replaying summaries that were captured without the PVCs
+	withoutClaims bool
+}
+
+// NewVolumeClaimIndex creates an index of the PVCs in namespace (all namespaces if empty) and of all PVs
+func NewVolumeClaimIndex(clientset kubernetes.Interface, namespace string) *VolumeClaimIndex {
+	return &VolumeClaimIndex{
+		clientset: clientset,
+		namespace: namespace,
+	}
+}
+
+// NewStaticVolumeClaimIndex creates an index of the given PVCs and PVs, e.g. read from a dump; either list may be
+// nil when it was not captured
+func NewStaticVolumeClaimIndex(pvcList *corev1.PersistentVolumeClaimList, pvList *corev1.PersistentVolumeList) *VolumeClaimIndex {
+	idx := &VolumeClaimIndex{}
+	idx.once.Do(func() {
+		if pvcList == nil {
+			idx.withoutClaims = true
+			idx.pvcs = make(map[string]*corev1.PersistentVolumeClaim)
+		} else {
+			idx.pvcs = make(map[string]*corev1.PersistentVolumeClaim, len(pvcList.Items))
+			for i := range pvcList.Items {
+				pvc := &pvcList.Items[i]
+				idx.pvcs[pvcKey(pvc.Namespace, pvc.Name)] = pvc
+			}
+		}
+		if pvList == nil {
+			idx.pvsErr = errors.New("the PVs were not captured")
+			return
+		}
+		idx.pvs = make(map[string]*corev1.PersistentVolume, len(pvList.Items))
+		for i := range pvList.Items {
+			pv := &pvList.Items[i]
+			idx.pvs[pv.Name] = pv
+		}
+	})
+	return idx
+}
+
+// pvcKey identifies a PVC by namespace/name
+func pvcKey(namespace string, name string) string {
+	return namespacedKey(namespace, name)
+}
+
+func (idx *VolumeClaimIndex) load(ctx context.Context) error {
+	idx.once.Do(func() {
+		pvcList, err := ListPVCs(ctx, idx.clientset, idx.namespace)
+		if err != nil {
+			idx.loadErr = errors.Wrapf(err, "failed to list PVCs")
+			return
+		}
+		idx.pvcs = make(map[string]*corev1.PersistentVolumeClaim, len(pvcList.Items))
+		for i := range pvcList.Items {
+			pvc := &pvcList.Items[i]
+			idx.pvcs[pvcKey(pvc.Namespace, pvc.Name)] = pvc
+		}
+
+		// PVs only enrich the claim, so a user who may not list them still gets results
+		pvList, err := ListPVs(ctx, idx.clientset)
+		if err != nil {
+			log.Warnf("unable to list PVs, continuing with PVC data only: %v", err)
+			idx.pvsErr = errors.Wrapf(err, "failed to list PVs")
+			return
+		}
+		idx.pvs = make(map[string]*corev1.PersistentVolume, len(pvList.Items))
+		for i := range pvList.Items {
+			pv := &pvList.Items[i]
+			idx.pvs[pv.Name] = pv
+		}
+	})
+	return idx.loadErr
+}
+
+// GetPVC returns the PVC with the given namespace and name; a PVC missing from the list, e.g. created after it was
+// listed, is fetched with a single Get
+func (idx *VolumeClaimIndex) GetPVC(ctx context.Context, namespace string, pvcName string) (*corev1.PersistentVolumeClaim, error) {
+	if err := idx.load(ctx); err != nil {
+		return nil, err
+	}
+	key := pvcKey(namespace, pvcName)
+	idx.mu.RLock()
+	pvc, ok := idx.pvcs[key]
+	missing := idx.missingPVCs[key]
+	idx.mu.RUnlock()
+	if ok {
+		return pvc, nil
+	}
+	notFoundErr := apierrors.NewNotFound(corev1.Resource("persistentvolumeclaims"), key)
+	if idx.clientset == nil || missing {
+		return nil, notFoundErr
+	}
+
+	pvc, err := idx.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if apierrors.IsNotFound(err) {
+		if idx.missingPVCs == nil {
+			idx.missingPVCs = make(map[string]bool)
+		}
+		idx.missingPVCs[key] = true
+		return nil, notFoundErr
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to get PVC %s", key)
+	}
+	idx.pvcs[key] = pvc
+	return pvc, nil
+}
+
+// GetPV returns the PV with the given name, or nil if it is unknown or PVs could not be listed
+func (idx *VolumeClaimIndex) GetPV(ctx context.Context, pvName string) *corev1.PersistentVolume {
+	if err := idx.load(ctx); err != nil {
+		return nil
+	}
+	return idx.pvs[pvName]
+}
+
+// GetPVName returns the name of the PV bound to the given PVC
+func (idx *VolumeClaimIndex) GetPVName(ctx context.Context, namespace string, pvcName string) (string, error) {
+	pvc, err := idx.GetPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return "", err
+	}
+	if 0 == len(pvc.Spec.VolumeName) {
+		return "", &claimNotBoundError{pvcKey: pvcKey(namespace, pvcName)}
+	}
+	return pvc.Spec.VolumeName, nil
+}
+
+// claimNotBoundError is returned for a PVC without a PV yet
+type claimNotBoundError struct {
+	pvcKey string
+}
+
+func (e *claimNotBoundError) Error() string {
+	return "persistentvolumeclaim " + e.pvcKey + " is not bound to a persistent volume"
+}
+
+// isUnresolvedClaimError reports whether a volume's PVC does not exist, e.g. because it was deleted since, or is not
+// bound yet; such volumes are skipped with a warning rather than failing their node
+func isUnresolvedClaimError(err error) bool {
+	var notBound *claimNotBoundError
+	return apierrors.IsNotFound(errors.Cause(err)) || errors.As(err, &notBound)
+}
+
+// StorageClassName returns the storage class of a claim, falling back to the one of its PV (e.g. for statically
+// provisioned volumes); pv may be nil
+func StorageClassName(pvc *corev1.PersistentVolumeClaim, pv *corev1.PersistentVolume) string {
+	if pvc != nil && pvc.Spec.StorageClassName != nil && 0 < len(*pvc.Spec.StorageClassName) {
+		return *pvc.Spec.StorageClassName
+	}
+	if pv != nil {
+		return pv.Spec.StorageClassName
+	}
+	return ""
+}
+
+// shortAccessModes abbreviates access modes the way kubectl does
+var shortAccessModes = map[corev1.PersistentVolumeAccessMode]string{
+	corev1.ReadWriteOnce:    "RWO",
+	corev1.ReadOnlyMany:     "ROX",
+	corev1.ReadWriteMany:    "RWX",
+	corev1.ReadWriteOncePod: "RWOP",
+}
+
+// EnrichOutputRowFromClaim copies the storage details of the PVC and of its PV into the row; pv may be nil
+func EnrichOutputRowFromClaim(row *OutputRowPVC, pvc *corev1.PersistentVolumeClaim, pv *corev1.PersistentVolume) {
+	row.StorageClass = StorageClassName(pvc, pv)
+	row.Phase = string(pvc.Status.Phase)
+
+	// the modes the volume was bound with, falling back to the requested ones while pending
+	accessModes := pvc.Status.AccessModes
+	if 0 == len(accessModes) {
+		accessModes = pvc.Spec.AccessModes
+	}
+	row.AccessModes = nil
+	for _, accessMode := range accessModes {
+		row.AccessModes = append(row.AccessModes, string(accessMode))
+	}
+
+	if pvc.Spec.VolumeMode != nil {
+		row.VolumeMode = string(*pvc.Spec.VolumeMode)
+	} else if pv != nil && pv.Spec.VolumeMode != nil {
+		row.VolumeMode = string(*pv.Spec.VolumeMode)
+	}
+	if requested, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		row.RequestedBytes = &requested
+	}
+	if !pvc.CreationTimestamp.IsZero() {
+		creationTimestamp := pvc.CreationTimestamp
+		row.CreationTimestamp = &creationTimestamp
+	}
+
+	if pv == nil {
+		return
+	}
+	row.ReclaimPolicy = string(pv.Spec.PersistentVolumeReclaimPolicy)
+	if pv.Spec.CSI != nil {
+		row.CSIDriver = pv.Spec.CSI.Driver
+		row.VolumeHandle = pv.Spec.CSI.VolumeHandle
+	}
+}
+
+// FormatAccessModes formats access modes as kubectl does, e.g. RWO,RWX
+func FormatAccessModes(accessModes []string) string {
+	var short []string
+	for _, accessMode := range accessModes {
+		if abbreviation, ok := shortAccessModes[corev1.PersistentVolumeAccessMode(accessMode)]; ok {
+			short = append(short, abbreviation)
+		} else {
+			short = append(short, accessMode)
+		}
+	}
+	return strings.Join(short, ",")
+}
+
+// FormatAge formats the time since creationTimestamp as kubectl does, e.g. 3d4h; unknown ages are empty
+func FormatAge(creationTimestamp *metav1.Time, now time.Time) string {
+	if creationTimestamp == nil || creationTimestamp.IsZero() {
+		return ""
+	}
+	return duration.HumanDuration(now.Sub(creationTimestamp.Time))
+}
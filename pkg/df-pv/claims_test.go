@@ -0,0 +1,160 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProduceOutputRowsConcurrentlyListsClaimsOnce(t *testing.T) {
+	cluster := &fakeCluster{nodeSummaries: map[string]string{}}
+	var nodeNames []string
+	for n := 0; n < 3; n++ {
+		nodeName := fmt.Sprintf("node-%d", n)
+		nodeNames = append(nodeNames, nodeName)
+		var volumes []string
+		for v := 0; v < 5; v++ {
+			pvcName := fmt.Sprintf("pvc-%d-%d", n, v)
+			cluster.pvcs = append(cluster.pvcs, newBoundPVC("ns", pvcName, "pv-"+pvcName))
+			cluster.pvs = append(cluster.pvs, corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-" + pvcName}})
+			volumes = append(volumes, fmt.Sprintf(`{"name":"vol-%d","capacityBytes":100,"usedBytes":10,"pvcRef":{"name":"%s","namespace":"ns"}}`, v, pvcName))
+		}
+		cluster.nodeSummaries[nodeName] = fmt.Sprintf(`{"pods":[{"podRef":{"name":"pod-%d","namespace":"ns"},"volume":[%s]}]}`, n, strings.Join(volumes, ","))
+	}
+	clientset := newFakeClusterClientset(t, cluster)
+
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	result := make(chan error, 1)
+	go func() {
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, nodeNames, NodeQueryOptions{}, outputRowPVCChan)
+	}()
+	rows := ConsumeOutputRowsConcurrently(outputRowPVCChan)
+	if err := <-result; err != nil {
+		t.Fatalf("ProduceOutputRowsConcurrently returned unexpected error: %v", err)
+	}
+
+	if len(rows) != 15 {
+		t.Fatalf("expected 15 rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		if row.PVName != "pv-"+row.PVCName {
+			t.Fatalf("row for %s has PV name %q", row.PVCName, row.PVName)
+		}
+	}
+	listCalls := map[string]int{}
+	for _, path := range cluster.requests() {
+		if !strings.HasPrefix(path, "/api/v1/nodes/") {
+			listCalls[path]++
+		}
+	}
+	if listCalls["/api/v1/persistentvolumeclaims"] != 1 || listCalls["/api/v1/persistentvolumes"] != 1 || len(listCalls) != 2 {
+		t.Fatalf("expected exactly one PVC and one PV list call, got %v", listCalls)
+	}
+}
+
+func TestVolumeClaimIndexSurfacesLookupFailures(t *testing.T) {
+	pending := newBoundPVC("ns", "pending", "")
+	clientset := newFakeClusterClientset(t, &fakeCluster{pvcs: []corev1.PersistentVolumeClaim{pending}})
+	claimIndex := NewVolumeClaimIndex(clientset, "")
+
+	if _, err := claimIndex.GetPVName(context.Background(), "ns", "missing"); err == nil || !strings.Contains(err.Error(), `"ns/missing" not found`) {
+		t.Fatalf("GetPVName error = %v, want not found error", err)
+	}
+	if _, err := claimIndex.GetPVName(context.Background(), "ns", "pending"); err == nil || !strings.Contains(err.Error(), "not bound") {
+		t.Fatalf("GetPVName error = %v, want not bound error", err)
+	}
+}
+
+func TestVolumeClaimIndexGetsClaimsCreatedAfterListing(t *testing.T) {
+	cluster := &fakeCluster{}
+	clientset := newFakeClusterClientset(t, cluster)
+	claimIndex := NewVolumeClaimIndex(clientset, "")
+	if err := claimIndex.load(context.Background()); err != nil {
+		t.Fatalf("load returned unexpected error: %v", err)
+	}
+	cluster.mu.Lock()
+	cluster.pvcs = append(cluster.pvcs, newBoundPVC("ns", "created", "pv-created"))
+	cluster.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if pvName, err := claimIndex.GetPVName(context.Background(), "ns", "created"); err != nil || pvName != "pv-created" {
+			t.Fatalf("GetPVName = %q, %v, want pv-created", pvName, err)
+		}
+		if _, err := claimIndex.GetPVName(context.Background(), "ns", "missing"); !isUnresolvedClaimError(err) {
+			t.Fatalf("GetPVName error = %v, want an unresolved claim error", err)
+		}
+	}
+	gets := 0
+	for _, path := range cluster.requests() {
+		if strings.HasPrefix(path, "/api/v1/namespaces/") {
+			gets++
+		}
+	}
+	if gets != 2 {
+		t.Fatalf("expected one Get per claim missing from the list, got %d", gets)
+	}
+}
+
+func TestStatsCollectionReportsClaimListFailureOnce(t *testing.T) {
+	clientset, _ := newTestClientset(t, http.StatusForbidden)
+	claimIndex := NewVolumeClaimIndex(clientset, "")
+
+	collection := &statsCollection{clientset: clientset, claimIndex: claimIndex, source: &NodeProxyStatsSource{Clientset: clientset, ClaimIndex: claimIndex}}
+	if err := collection.loadClaims(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to list PVCs") {
+		t.Fatalf("loadClaims error = %v, want the PVC list failure", err)
+	}
+	collection.source = &PrometheusStatsSource{ClaimIndex: claimIndex}
+	if err := collection.loadClaims(context.Background()); err != nil {
+		t.Fatalf("loadClaims returned %v for the prometheus source, which does without the PVCs", err)
+	}
+}
+
+func TestEnrichOutputRowFromClaim(t *testing.T) {
+	block := corev1.PersistentVolumeBlock
+	created := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	pvc := newBoundPVC("ns", "pvc-a", "pv-a")
+	pvc.CreationTimestamp = created
+	pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	pvc.Status.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadWriteMany}
+	pvc.Spec.VolumeMode = &block
+	pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	pv := &corev1.PersistentVolume{Spec: corev1.PersistentVolumeSpec{
+		StorageClassName:              "gp3",
+		PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+		PersistentVolumeSource: corev1.PersistentVolumeSource{
+			CSI: &corev1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-0123"},
+		},
+	}}
+
+	row := &OutputRowPVC{}
+	EnrichOutputRowFromClaim(row, &pvc, pv)
+	if row.StorageClass != "gp3" || row.VolumeMode != "Block" || row.ReclaimPolicy != "Retain" || row.CSIDriver != "ebs.csi.aws.com" || row.VolumeHandle != "vol-0123" {
+		t.Fatalf("unexpected storage details: %+v", row)
+	}
+	if got := FormatAccessModes(row.AccessModes); got != "RWO,RWX" {
+		t.Fatalf("access modes = %q, want the bound modes RWO,RWX", got)
+	}
+	if row.RequestedBytes == nil || row.RequestedBytes.Value() != 10<<30 {
+		t.Fatalf("requested bytes = %v, want 10Gi", row.RequestedBytes)
+	}
+	if got := FormatAge(row.CreationTimestamp, created.Add(49*time.Hour)); got != "2d1h" {
+		t.Fatalf("FormatAge = %q, want 2d1h", got)
+	}
+
+	// without the PV, only what the PVC knows is filled in
+	row = &OutputRowPVC{}
+	EnrichOutputRowFromClaim(row, &pvc, nil)
+	if row.ReclaimPolicy != "" || row.CSIDriver != "" || row.VolumeMode != "Block" {
+		t.Fatalf("unexpected storage details without a PV: %+v", row)
+	}
+	if got := FormatAge(nil, time.Now()); got != "" {
+		t.Fatalf("FormatAge(nil) = %q, want empty", got)
+	}
+}
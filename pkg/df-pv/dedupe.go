@@ -0,0 +1,115 @@
+package df_pv
+
+import (
+	"sort"
+	"strings"
+)
+
+// VolumeConsumer is a pod mounting a volume, along with the workload owning the pod when owners are resolved
+type VolumeConsumer struct {
+	PodName         string `json:"podName"`
+	NodeName        string `json:"nodeName"`
+	VolumeMountName string `json:"volumeMountName"`
+	OwnerKind       string `json:"ownerKind,omitempty"`
+	OwnerName       string `json:"owner,omitempty"`
+}
+
+// volumeKey identifies a volume regardless of how many pods mount it; claims that are not bound yet are
+// identified by their name, and orphaned PVs, whose former claims may share a name, by the PV name
+func volumeKey(row *OutputRowPVC) string {
+	if row.PVName != "" {
+		return row.PVName
+	}
+	return pvcKey(row.Namespace, row.PVCName)
+}
+
+// DeduplicateOutputRows collapses the rows of a volume mounted by several pods into one row listing all its
+// consumers; the pod, node and mount names of the collapsed row are the comma separated names of all consumers, and
+// so are its owner kinds and names when its pods belong to different workloads, e.g. two Deployments sharing a RWX
+// volume. The collapsed rows are copies, the given rows are left untouched
+func DeduplicateOutputRows(sliceOfOutputRowPVC []*OutputRowPVC) []*OutputRowPVC {
+	var deduplicated []*OutputRowPVC
+	rowsByVolume := make(map[string]*OutputRowPVC)
+	for _, row := range sliceOfOutputRowPVC {
+		consumer := VolumeConsumer{PodName: row.PodName, NodeName: row.NodeName, VolumeMountName: row.VolumeMountName, OwnerKind: row.OwnerKind, OwnerName: row.OwnerName}
+		volumeRow, ok := rowsByVolume[volumeKey(row)]
+		if !ok {
+			copied := *row
+			volumeRow = &copied
+			volumeRow.Consumers = nil
+			rowsByVolume[volumeKey(row)] = volumeRow
+			deduplicated = append(deduplicated, volumeRow)
+		}
+		// unmounted volumes have no consumer
+		if consumer.PodName != "" {
+			volumeRow.Consumers = append(volumeRow.Consumers, consumer)
+		}
+	}
+
+	for _, row := range deduplicated {
+		if len(row.Consumers) <= 1 {
+			continue
+		}
+		sort.SliceStable(row.Consumers, func(i, j int) bool {
+			return row.Consumers[i].PodName < row.Consumers[j].PodName
+		})
+		var podNames, nodeNames, mountNames, ownerKinds, ownerNames []string
+		seenOwners := make(map[string]bool)
+		for _, consumer := range row.Consumers {
+			podNames = appendUnique(podNames, consumer.PodName)
+			nodeNames = appendUnique(nodeNames, consumer.NodeName)
+			mountNames = appendUnique(mountNames, consumer.VolumeMountName)
+			// pods whose owner is unknown, e.g. deleted since, add no owner
+			owner := consumer.OwnerKind + "/" + consumer.OwnerName
+			if consumer.OwnerKind != "" && !seenOwners[owner] {
+				seenOwners[owner] = true
+				ownerKinds = appendUnique(ownerKinds, consumer.OwnerKind)
+				ownerNames = append(ownerNames, consumer.OwnerName)
+			}
+		}
+		row.PodName = strings.Join(podNames, ",")
+		row.NodeName = strings.Join(nodeNames, ",")
+		row.VolumeMountName = strings.Join(mountNames, ",")
+		row.OwnerKind = strings.Join(ownerKinds, ",")
+		row.OwnerName = strings.Join(ownerNames, ",")
+	}
+	return deduplicated
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// uniqueVolumes returns the first row of every volume, so that totals count a volume mounted by several pods once
+func uniqueVolumes(sliceOfOutputRowPVC []*OutputRowPVC) []*OutputRowPVC {
+	var unique []*OutputRowPVC
+	seen := make(map[string]bool)
+	for _, row := range sliceOfOutputRowPVC {
+		if seen[volumeKey(row)] {
+			continue
+		}
+		seen[volumeKey(row)] = true
+		unique = append(unique, row)
+	}
+	return unique
+}
+
+// FormatConsumers formats the pods mounting a volume as pod@node pairs
+func FormatConsumers(row *OutputRowPVC) string {
+	if 0 == len(row.Consumers) {
+		if row.PodName == "" {
+			return ""
+		}
+		return row.PodName + "@" + row.NodeName
+	}
+	var consumers []string
+	for _, consumer := range row.Consumers {
+		consumers = appendUnique(consumers, consumer.PodName+"@"+consumer.NodeName)
+	}
+	return strings.Join(consumers, ",")
+}
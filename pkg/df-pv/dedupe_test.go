@@ -0,0 +1,96 @@
+package df_pv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeduplicateOutputRows(t *testing.T) {
+	rows := []*OutputRowPVC{
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-b", "node-2"),
+		withConsumer(newTestRow("ns", "single", 100, 10), "db-0", "node-1"),
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-a", "node-1"),
+		withConsumer(newTestRow("other", "shared", 100, 20), "web-a", "node-1"),
+	}
+
+	deduplicated := DeduplicateOutputRows(rows)
+	if len(deduplicated) != 3 {
+		t.Fatalf("expected 3 volumes, got %d", len(deduplicated))
+	}
+	shared := deduplicated[0]
+	if shared.PodName != "web-a,web-b" || shared.NodeName != "node-1,node-2" || shared.VolumeMountName != "data" {
+		t.Fatalf("unexpected collapsed row: pod=%q node=%q mount=%q", shared.PodName, shared.NodeName, shared.VolumeMountName)
+	}
+	if got := FormatConsumers(shared); got != "web-a@node-1,web-b@node-2" {
+		t.Fatalf("FormatConsumers = %q", got)
+	}
+	if single := deduplicated[1]; single.PodName != "db-0" || FormatConsumers(single) != "db-0@node-1" {
+		t.Fatalf("unexpected single consumer row: %+v", single)
+	}
+	if shared == rows[0] || rows[0].PodName != "web-b" || rows[0].NodeName != "node-2" || rows[0].Consumers != nil {
+		t.Fatalf("DeduplicateOutputRows modified the given rows: %+v", rows[0])
+	}
+}
+
+func TestDeduplicateOutputRowsListsEveryOwner(t *testing.T) {
+	withOwner := func(row *OutputRowPVC, ownerKind string, ownerName string) *OutputRowPVC {
+		row.OwnerKind, row.OwnerName = ownerKind, ownerName
+		return row
+	}
+	rows := DeduplicateOutputRows([]*OutputRowPVC{
+		withOwner(withConsumer(newTestRow("ns", "shared", 100, 40), "web-a", "node-1"), "Deployment", "web"),
+		withOwner(withConsumer(newTestRow("ns", "shared", 100, 40), "api-b", "node-2"), "Deployment", "api"),
+		withOwner(withConsumer(newTestRow("ns", "shared", 100, 40), "web-b", "node-2"), "Deployment", "web"),
+		withOwner(withConsumer(newTestRow("ns", "web-only", 100, 10), "web-a", "node-1"), "Deployment", "web"),
+		withOwner(withConsumer(newTestRow("ns", "web-only", 100, 10), "web-b", "node-2"), "Deployment", "web"),
+	})
+
+	if shared := rows[0]; shared.OwnerKind != "Deployment" || shared.OwnerName != "api,web" {
+		t.Fatalf("owner of the volume shared by two Deployments = %s/%s, want Deployment/api,web", shared.OwnerKind, shared.OwnerName)
+	}
+	if webOnly := rows[1]; webOnly.OwnerKind != "Deployment" || webOnly.OwnerName != "web" {
+		t.Fatalf("owner of the volume of one Deployment = %s/%s, want Deployment/web", webOnly.OwnerKind, webOnly.OwnerName)
+	}
+	var got []string
+	for _, group := range GroupOutputRows(rows, groupByOwner) {
+		got = append(got, group.Key)
+	}
+	if want := []string{"ns/Deployment/api,web", "ns/Deployment/web"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("owner groups = %v, want %v", got, want)
+	}
+}
+
+func TestGroupOutputRowsByNodeKeepsVolumesOfSeveralNodesTogether(t *testing.T) {
+	rows := DeduplicateOutputRows([]*OutputRowPVC{
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-a", "node-2"),
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-b", "node-1"),
+		withConsumer(newTestRow("ns", "other-shared", 100, 20), "api-a", "node-1"),
+		withConsumer(newTestRow("ns", "other-shared", 100, 20), "api-b", "node-2"),
+		withConsumer(newTestRow("ns", "single", 100, 10), "db-0", "node-1"),
+	})
+
+	groups := GroupOutputRows(rows, groupByNode)
+	if len(groups) != 2 || groups[0].Key != "node-1" || groups[1].Key != "node-1,node-2" {
+		t.Fatalf("expected the volumes mounted on both nodes to be grouped under node-1,node-2, got %+v", groups)
+	}
+	if groups[1].Volumes != 2 || quantityValue(groups[1].Subtotal.UsedBytes) != 60 || quantityValue(groups[0].Subtotal.UsedBytes) != 10 {
+		t.Fatalf("unexpected node subtotals: %+v, %+v", groups[0].Subtotal, groups[1].Subtotal)
+	}
+}
+
+func TestSumOutputRowsCountsSharedVolumesOnce(t *testing.T) {
+	rows := []*OutputRowPVC{
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-a", "node-1"),
+		withConsumer(newTestRow("ns", "shared", 100, 40), "web-b", "node-2"),
+		withConsumer(newTestRow("ns", "single", 100, 10), "db-0", "node-1"),
+	}
+
+	total := SumOutputRows(rows)
+	if total.UsedBytes.Value() != 50 || total.CapacityBytes.Value() != 200 {
+		t.Fatalf("expected used=50 capacity=200, got used=%d capacity=%d", total.UsedBytes.Value(), total.CapacityBytes.Value())
+	}
+	groups := GroupOutputRows(rows, groupByNamespace)
+	if len(groups) != 1 || groups[0].Volumes != 2 || len(groups[0].Rows) != 3 {
+		t.Fatalf("expected one group of 2 volumes in 3 rows, got %+v", groups)
+	}
+}
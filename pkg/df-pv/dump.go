@@ -0,0 +1,220 @@
+package df_pv
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+func setupDumpCommand(flags *flagpole) *cobra.Command {
+	var dumpCmd = &cobra.Command{
+		Use:   "dump",
+		Short: "Capture the node stats and the PVCs and PVs into a tarball for offline analysis",
+		Long: `dump saves the raw stats/summary response of every queried node along with the PVC and PV lists into a gzipped tarball
+
+Replay it later, without access to the cluster, with: df-pv --from-dir <tarball>
+
+The stats/summary responses contain the names and resource usage of every pod running on the queried nodes, not only the ones with volumes`,
+		Args:         cobra.MaximumNArgs(0),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDump(flags)
+		},
+	}
+
+	dumpCmd.Flags().StringVarP(&flags.dumpFile, "file", "f", "df-pv-dump.tar.gz", "tarball to write; - for stdout")
+	addCollectionFlags(dumpCmd.Flags(), flags)
+
+	return dumpCmd
+}
+
+func runDump(flags *flagpole) error {
+	if _, err := flags.namespaceFilter(); err != nil {
+		return errors.Wrap(err, "invalid namespace selection")
+	}
+	if err := flags.nodeQueryOptions().validate(); err != nil {
+		return errors.Wrap(err, "invalid node query options")
+	}
+
+	logLevel, _ := log.ParseLevel(flags.logLevel)
+	log.SetLevel(logLevel)
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+
+	dump, err := CaptureDump(context.Background(), flags)
+	var nodeCollectionErr *NodeCollectionError
+	if errors.As(err, &nodeCollectionErr) {
+		if printErr := PrintNodeErrors(os.Stderr, nodeCollectionErr); printErr != nil {
+			return errors.Wrap(printErr, "error printing failed nodes")
+		}
+		if !nodeCollectionErr.IsPartial() {
+			return &ExitCodeError{Code: exitCodeError, Err: errors.Wrapf(err, "error capturing dump")}
+		}
+	} else if err != nil {
+		return errors.Wrapf(err, "error capturing dump")
+	}
+
+	if err := saveDump(flags.dumpFile, dump, time.Now()); err != nil {
+		return err
+	}
+	log.Infof("saved the stats of %d nodes to '%s'", len(dump.NodeSummaries), flags.dumpFile)
+	return partialResultsError(nodeCollectionErr)
+}
+
+// saveDump writes the dump to the given file, or to stdout for "-"; the file is closed before returning so that
+// a write failing only when flushed is reported too
+func saveDump(path string, dump *Dump, capturedAt time.Time) error {
+	if path == "-" {
+		return errors.Wrapf(WriteDump(os.Stdout, dump, capturedAt), "unable to write dump")
+	}
+	dumpFile, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create dump")
+	}
+	if err := WriteDump(dumpFile, dump, capturedAt); err != nil {
+		_ = dumpFile.Close()
+		return errors.Wrapf(err, "unable to write dump")
+	}
+	return errors.Wrapf(dumpFile.Close(), "unable to write dump")
+}
+
+// CaptureDump queries the stats/summary response of the nodes selected by the flags along with the PVCs and PVs;
+// failed nodes are returned as a *NodeCollectionError along with the dump of the remaining ones
+func CaptureDump(ctx context.Context, flags *flagpole) (*Dump, error) {
+	ctx, cancel, err := flags.withRequestTimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	clientset, err := flags.newClientset()
+	if err != nil {
+		return nil, err
+	}
+	namespaceFilter, err := flags.resolveNamespaceFilter(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	sliceOfNodeName, err := GetNodesToQuery(ctx, clientset, namespaceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &Dump{}
+	dump.PVCs, err = ListPVCs(ctx, clientset, namespaceFilter.SingleNamespace())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list PVCs")
+	}
+	dump.PVs, err = ListPVs(ctx, clientset)
+	if err != nil {
+		log.Warnf("unable to list PVs, the dump will only contain the PVCs: %v", err)
+		dump.PVs = nil
+	}
+
+	queryOptions, err := flags.withKubeletClient(ctx, clientset, flags.nodeQueryOptions())
+	if err != nil {
+		return nil, err
+	}
+	dump.NodeSummaries, err = GetStatsSummariesFromNodes(ctx, clientset, sliceOfNodeName, queryOptions)
+	return dump, err
+}
+
+// GetStatsSummariesFromNodes gets the stats/summary responses of the nodes using at most
+// queryOptions.MaxConcurrency workers; like ProduceOutputRowsConcurrently, failed nodes are returned as a
+// *NodeCollectionError along with the responses of the remaining ones
+func GetStatsSummariesFromNodes(ctx context.Context, clientset kubernetes.Interface, nodeNames []string, queryOptions NodeQueryOptions) ([]NodeSummary, error) {
+	nodeNameChan := make(chan string, len(nodeNames))
+	totalNodes := 0
+	for _, nodeName := range nodeNames {
+		if nodeName == "" {
+			log.Warnf("skipping empty node name")
+			continue
+		}
+		totalNodes++
+		nodeNameChan <- nodeName
+	}
+	close(nodeNameChan)
+
+	var mu sync.Mutex
+	var summaries []NodeSummary
+	var workerGroup run.Group
+	var failedNodes nodeErrorRecorder
+	for worker := 0; worker < queryOptions.workers(totalNodes); worker++ {
+		workerGroup.Add(func() error {
+			for nodeName := range nodeNameChan {
+				summary, err := GetStatsSummaryFromNode(ctx, clientset, nodeName, queryOptions)
+				if err != nil {
+					log.Debugf("failed to get stats from node '%s': %v", nodeName, err)
+					failedNodes.record(nodeName, err)
+					continue
+				}
+				mu.Lock()
+				summaries = append(summaries, NodeSummary{NodeName: nodeName, Summary: summary})
+				mu.Unlock()
+			}
+			return nil
+		}, func(error) {})
+	}
+	if err := workerGroup.Run(); err != nil {
+		return nil, err
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].NodeName < summaries[j].NodeName })
+	return summaries, failedNodes.result(totalNodes)
+}
+
+// WriteDump writes a dump as a gzipped tarball with the node responses under nodes/ and the PVC and PV lists next to it
+func WriteDump(w io.Writer, dump *Dump, capturedAt time.Time) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	writeFile := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: capturedAt, Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tarWriter.Write(content)
+		return err
+	}
+
+	for _, nodeSummary := range dump.NodeSummaries {
+		if err := writeFile(path.Join(dumpNodesDir, nodeSummary.NodeName+".json"), nodeSummary.Summary); err != nil {
+			return err
+		}
+	}
+	if dump.PVCs != nil {
+		content, err := json.Marshal(dump.PVCs)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(dumpPVCsFile, content); err != nil {
+			return err
+		}
+	}
+	if dump.PVs != nil {
+		content, err := json.Marshal(dump.PVs)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(dumpPVsFile, content); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
@@ -0,0 +1,340 @@
+package df_pv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// PodExecutor runs a command in a container of a pod and returns what it printed
+type PodExecutor interface {
+	Exec(ctx context.Context, namespace string, podName string, containerName string, command []string) (stdout string, stderr string, err error)
+}
+
+// remotePodExecutor runs commands through the pods/exec subresource, like kubectl exec
+type remotePodExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// NewRemotePodExecutor creates an executor running commands through the pods/exec subresource
+func NewRemotePodExecutor(config *rest.Config, clientset kubernetes.Interface) PodExecutor {
+	return &remotePodExecutor{config: config, clientset: clientset}
+}
+
+func (e *remotePodExecutor) Exec(ctx context.Context, namespace string, podName string, containerName string, command []string) (string, string, error) {
+	request := e.clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(namespace).Name(podName).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{Container: containerName, Command: command, Stdout: true, Stderr: true}, scheme.ParameterCodec)
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(e.config, "POST", request.URL())
+	if err != nil {
+		return "", "", err
+	}
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(e.config, "GET", request.URL().String())
+	if err != nil {
+		return "", "", err
+	}
+	// the same fallback as kubectl exec, for API servers that do not serve exec over websockets yet
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	return stdout.String(), stderr.String(), err
+}
+
+// ExecStatsSource measures the volumes with df inside the pods mounting them, for users who may only exec into the
+// pods of their namespaces and for provisioners the kubelet reports nothing useful for
+type ExecStatsSource struct {
+	Clientset       kubernetes.Interface
+	Executor        PodExecutor
+	ClaimIndex      *VolumeClaimIndex
+	NamespaceFilter *NamespaceFilter
+	QueryOptions    NodeQueryOptions
+
+	// podsOnNode holds the running pods with PVCs, listed by Nodes
+	podsOnNode map[string][]corev1.Pod
+}
+
+// Nodes returns the nodes running pods with PVCs in the selected namespaces
+func (s *ExecStatsSource) Nodes(ctx context.Context) ([]string, error) {
+	podsOnNode, err := ListRunningPodsWithClaimsByNode(ctx, s.Clientset, s.NamespaceFilter)
+	if err != nil {
+		return nil, err
+	}
+	s.podsOnNode = podsOnNode
+	var sliceOfNodeName []string
+	for nodeName := range s.podsOnNode {
+		sliceOfNodeName = append(sliceOfNodeName, nodeName)
+	}
+	sort.Strings(sliceOfNodeName)
+	return sliceOfNodeName, nil
+}
+
+// ListRunningPodsWithClaimsByNode lists the running pods with PVCs in the selected namespaces, by node
+func ListRunningPodsWithClaimsByNode(ctx context.Context, clientset kubernetes.Interface, namespaceFilter *NamespaceFilter) (map[string][]corev1.Pod, error) {
+	podsOnNode := make(map[string][]corev1.Pod)
+	if namespaceFilter != nil && namespaceFilter.Include != nil && 0 == len(namespaceFilter.Include) {
+		return podsOnNode, nil
+	}
+	sliceOfPod, err := ListPodsWithPersistentVolumeClaims(ctx, clientset, namespaceFilter.SingleNamespace())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list pods")
+	}
+	// a pod is listed once per PVC it mounts
+	listed := make(map[string]struct{})
+	for _, pod := range sliceOfPod {
+		key := pod.Namespace + "/" + pod.Name
+		if _, ok := listed[key]; ok || !namespaceFilter.Matches(pod.Namespace) || pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+		listed[key] = struct{}{}
+		podsOnNode[pod.Spec.NodeName] = append(podsOnNode[pod.Spec.NodeName], pod)
+	}
+	return podsOnNode, nil
+}
+
+// Collect measures the volumes of the pods of the nodes using at most QueryOptions.MaxConcurrency workers; a node
+// fails when any of its volumes cannot be measured, along with the rows of the other ones
+func (s *ExecStatsSource) Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+	defer close(outputRowPVCChan)
+
+	nodeNameChan := make(chan string, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		nodeNameChan <- nodeName
+	}
+	close(nodeNameChan)
+
+	var workerGroup run.Group
+	var failedNodes nodeErrorRecorder
+	for worker := 0; worker < s.QueryOptions.workers(len(nodeNames)); worker++ {
+		workerGroup.Add(func() error {
+			for nodeName := range nodeNameChan {
+				sliceOfOutputRowPVC, err := s.collectNode(ctx, nodeName)
+				if err != nil {
+					log.Debugf("failed to measure volumes on node '%s': %v", nodeName, err)
+					failedNodes.record(nodeName, err)
+				}
+				for _, outputRowPVC := range sliceOfOutputRowPVC {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case outputRowPVCChan <- outputRowPVC:
+					}
+				}
+			}
+			return nil
+		}, func(error) {})
+	}
+	if err := workerGroup.Run(); err != nil {
+		return err
+	}
+	return failedNodes.result(len(nodeNames))
+}
+
+// collectNode measures every PVC of the pods of a node once, in the first running container mounting it
+func (s *ExecStatsSource) collectNode(ctx context.Context, nodeName string) ([]*OutputRowPVC, error) {
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	var firstErr error
+	failed, total := 0, 0
+	measured := make(map[string]*Volume)
+	for _, pod := range s.podsOnNode[nodeName] {
+		for _, podVolume := range pod.Spec.Volumes {
+			if podVolume.PersistentVolumeClaim == nil || podVolume.PersistentVolumeClaim.ClaimName == "" {
+				continue
+			}
+			pvcName := podVolume.PersistentVolumeClaim.ClaimName
+			containerName, mountPath, ok := findVolumeMount(&pod, podVolume.Name)
+			if !ok {
+				log.Debugf("no running container of pod '%s/%s' mounts volume '%s'; skipping it", pod.Namespace, pod.Name, podVolume.Name)
+				continue
+			}
+			total++
+			vol, ok := measured[pvcKey(pod.Namespace, pvcName)]
+			if !ok {
+				var err error
+				vol, err = s.measure(ctx, &pod, containerName, mountPath)
+				if err != nil {
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				measured[pvcKey(pod.Namespace, pvcName)] = vol
+			}
+
+			volumeOfPod := *vol
+			volumeOfPod.Name = podVolume.Name
+			volumeOfPod.PvcRef.PvcName = pvcName
+			volumeOfPod.PvcRef.PvcNamespace = pod.Namespace
+			podRef := &Pod{}
+			podRef.PodRef.Name = pod.Name
+			podRef.PodRef.Namespace = pod.Namespace
+			outputRowPVC, err := GetOutputRowPVCFromPodAndVolume(ctx, s.ClaimIndex, podRef, &volumeOfPod, s.NamespaceFilter)
+			if isUnresolvedClaimError(err) {
+				log.Warnf("skipping volume '%s' of pod '%s/%s' on node '%s': %v", podVolume.Name, pod.Namespace, pod.Name, nodeName, err)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if outputRowPVC == nil {
+				continue
+			}
+			outputRowPVC.NodeName = nodeName
+			outputRowPVC.Source = sourceExec
+			sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, outputRowPVC)
+		}
+	}
+	if firstErr != nil {
+		return sliceOfOutputRowPVC, errors.Wrapf(firstErr, "unable to measure %d of %d volumes", failed, total)
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+// findVolumeMount returns the first running container of a pod mounting the volume, and where it mounts it
+func findVolumeMount(pod *corev1.Pod, volumeName string) (string, string, bool) {
+	running := make(map[string]bool)
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		running[containerStatus.Name] = containerStatus.State.Running != nil
+	}
+	for _, container := range pod.Spec.Containers {
+		if !running[container.Name] {
+			continue
+		}
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name == volumeName {
+				return container.Name, volumeMount.MountPath, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// measure runs df -kP and df -iP on the mount path; inodes are left unknown when df cannot report them
+func (s *ExecStatsSource) measure(ctx context.Context, pod *corev1.Pod, containerName string, mountPath string) (*Volume, error) {
+	stdout, err := s.df(ctx, pod, containerName, "-kP", mountPath)
+	if err != nil {
+		return nil, err
+	}
+	kilobytes, err := parseDfOutput(stdout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected df -kP output in container '%s' of pod '%s/%s'", containerName, pod.Namespace, pod.Name)
+	}
+	vol := &Volume{
+		CapacityBytes:  int64(kilobytes[0] * 1024),
+		UsedBytes:      int64(kilobytes[1] * 1024),
+		AvailableBytes: int64(kilobytes[2] * 1024),
+	}
+
+	stdout, err = s.df(ctx, pod, containerName, "-iP", mountPath)
+	if err == nil {
+		var inodes [3]uint64
+		if inodes, err = parseDfOutput(stdout); err == nil {
+			vol.Inodes, vol.InodesUsed, vol.InodesFree = inodes[0], inodes[1], inodes[2]
+		}
+	}
+	if err != nil {
+		log.Debugf("unable to count the inodes of '%s' in container '%s' of pod '%s/%s': %v", mountPath, containerName, pod.Namespace, pod.Name, err)
+	}
+	return vol, nil
+}
+
+// df runs df with the given option on the mount path, with the node timeout
+func (s *ExecStatsSource) df(ctx context.Context, pod *corev1.Pod, containerName string, option string, mountPath string) (string, error) {
+	if s.QueryOptions.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.QueryOptions.Timeout)
+		defer cancel()
+	}
+	stdout, stderr, err := s.Executor.Exec(ctx, pod.Namespace, pod.Name, containerName, []string{"df", option, mountPath})
+	if err == nil {
+		return stdout, nil
+	}
+	if isCommandNotFound(err, stderr) {
+		return "", fmt.Errorf("df is not available in container '%s' of pod '%s/%s' (e.g. a distroless image); use another source for its volumes", containerName, pod.Namespace, pod.Name)
+	}
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return "", errors.Wrapf(err, "df %s failed in container '%s' of pod '%s/%s': %s", option, containerName, pod.Namespace, pod.Name, stderr)
+	}
+	return "", errors.Wrapf(err, "df %s failed in container '%s' of pod '%s/%s'", option, containerName, pod.Namespace, pod.Name)
+}
+
+// isCommandNotFound reports whether an exec failed because the command does not exist in the container, as reported
+// by the container runtime or by a shell
+func isCommandNotFound(err error, stderr string) bool {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && (exitErr.ExitStatus() == 126 || exitErr.ExitStatus() == 127) {
+		return true
+	}
+	message := err.Error() + " " + stderr
+	return strings.Contains(message, "executable file not found") || strings.Contains(message, "no such file or directory")
+}
+
+// dfCapacityPattern matches the capacity column of df -P, which follows the three numeric columns
+var dfCapacityPattern = regexp.MustCompile(`^([0-9]+%|-)$`)
+
+// parseDfOutput parses the POSIX output of df -kP or df -iP for a single path into its total, used and available
+// (or free) columns; a column df cannot tell, reported as "-", is 0
+func parseDfOutput(output string) ([3]uint64, error) {
+	var values [3]uint64
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return values, fmt.Errorf("expected a header and a line, got %q", output)
+	}
+	// the file system name may contain spaces, so the numeric columns are found from the capacity column
+	fields := strings.Fields(lines[len(lines)-1])
+	capacityIndex := -1
+	for i := 4; i < len(fields); i++ {
+		if dfCapacityPattern.MatchString(fields[i]) {
+			capacityIndex = i
+			break
+		}
+	}
+	if capacityIndex < 0 {
+		return values, fmt.Errorf("no capacity column in %q", lines[len(lines)-1])
+	}
+	for i, field := range fields[capacityIndex-3 : capacityIndex] {
+		if field == "-" {
+			continue
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return values, errors.Wrapf(err, "invalid df column %q", field)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// newExecStatsSource creates the exec source with the credentials of the kubeconfig
+func (flags *flagpole) newExecStatsSource(clientset kubernetes.Interface, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter) (*ExecStatsSource, error) {
+	kubeConfig, err := GetKubeConfigFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build config from flags")
+	}
+	return &ExecStatsSource{
+		Clientset:       clientset,
+		Executor:        NewRemotePodExecutor(kubeConfig, clientset),
+		ClaimIndex:      claimIndex,
+		NamespaceFilter: namespaceFilter,
+		QueryOptions:    flags.nodeQueryOptions(),
+	}, nil
+}
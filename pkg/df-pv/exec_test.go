@@ -0,0 +1,146 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+func TestParseDfOutput(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		output  string
+		want    [3]uint64
+		wantErr string
+	}{
+		{
+			name:   "GNU df -kP",
+			output: "Filesystem     1024-blocks    Used Available Capacity Mounted on\n/dev/sdb          10255636 2097152   8158484      21% /var/lib/db\n",
+			want:   [3]uint64{10255636, 2097152, 8158484},
+		},
+		{
+			name:   "GNU df -iP",
+			output: "Filesystem      Inodes IUsed   IFree IUse% Mounted on\n/dev/sdb        655360  1234  654126    1% /var/lib/db\n",
+			want:   [3]uint64{655360, 1234, 654126},
+		},
+		{
+			name:   "busybox df -kP on a file system name with spaces",
+			output: "Filesystem           1024-blocks      Used Available Capacity Mounted on\nnfs server:/exports  104857600  52428800  52428800  50% /data\n",
+			want:   [3]uint64{104857600, 52428800, 52428800},
+		},
+		{
+			name:   "df -iP of a file system without inodes",
+			output: "Filesystem     Inodes IUsed IFree IUse% Mounted on\nfuse               -     -     -     - /data\n",
+		},
+		{name: "no line", output: "Filesystem 1024-blocks Used Available Capacity Mounted on\n", wantErr: "expected a header and a line"},
+		{name: "not df", output: "usage: df [-k]\nunknown option -P\n", wantErr: "no capacity column"},
+	} {
+		got, err := parseDfOutput(tc.output)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%s: parseDfOutput error = %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: parseDfOutput = %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+// fakePodExecutor answers df on the mount paths of the containers it knows, and fails like a container runtime in
+// the other ones
+type fakePodExecutor struct {
+	mu       sync.Mutex
+	mounts   map[string]string
+	commands []string
+}
+
+func (e *fakePodExecutor) Exec(ctx context.Context, namespace string, podName string, containerName string, command []string) (string, string, error) {
+	e.mu.Lock()
+	e.commands = append(e.commands, fmt.Sprintf("%s/%s/%s: %s", namespace, podName, containerName, strings.Join(command, " ")))
+	e.mu.Unlock()
+
+	filesystem, ok := e.mounts[containerName+":"+command[2]]
+	if !ok {
+		return "", "", utilexec.CodeExitError{Err: errors.New(`OCI runtime exec failed: exec failed: unable to start container process: exec: "df": executable file not found in $PATH`), Code: 126}
+	}
+	if command[1] == "-iP" {
+		return "Filesystem Inodes IUsed IFree IUse% Mounted on\n" + filesystem + " 1000 100 900 10% " + command[2] + "\n", "", nil
+	}
+	return "Filesystem 1024-blocks Used Available Capacity Mounted on\n" + filesystem + " 1000 250 750 25% " + command[2] + "\n", "", nil
+}
+
+func TestExecStatsSource(t *testing.T) {
+	pending := withMount(newPodWithPVC("team-a", "db-1", "node-1", "data-db-1"), "db", "/var/lib/db")
+	pending.Status.Phase = corev1.PodPending
+	waiting := withMount(newPodWithPVC("team-a", "db-2", "node-1", "data-db-2"), "db", "/var/lib/db")
+	waiting.Status.ContainerStatuses[0].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	clientset := fake.NewClientset(
+		withMount(newPodWithPVC("team-a", "db-0", "node-1", "data-db-0"), "db", "/var/lib/db"),
+		pending,
+		waiting,
+		withMount(newPodWithPVC("team-b", "web-0", "node-1", "uploads"), "web", "/srv/uploads"),
+		withMount(newPodWithPVC("team-b", "web-1", "node-1", "uploads"), "web", "/srv/uploads"),
+		withMount(newPodWithPVC("team-b", "static-0", "node-2", "assets"), "distroless", "/assets"),
+		// data-db-3 is not bound yet and data-db-4 was deleted since the pod was created
+		withMount(newPodWithPVC("team-a", "db-3", "node-1", "data-db-3"), "db", "/var/lib/db"),
+		withMount(newPodWithPVC("team-a", "db-4", "node-1", "data-db-4"), "db", "/var/lib/db"),
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data-db-3"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data-db-0"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-db"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "uploads"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-uploads"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "assets"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-assets"}},
+	)
+	executor := &fakePodExecutor{mounts: map[string]string{"db:/var/lib/db": "/dev/sdb", "web:/srv/uploads": "nfs:/uploads"}}
+	source := &ExecStatsSource{
+		Clientset:  clientset,
+		Executor:   executor,
+		ClaimIndex: NewVolumeClaimIndex(clientset, ""),
+	}
+
+	nodeNames, err := source.Nodes(context.Background())
+	if err != nil || strings.Join(nodeNames, ",") != "node-1,node-2" {
+		t.Fatalf("Nodes = %v, %v, want [node-1 node-2]", nodeNames, err)
+	}
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	collectErrChan := make(chan error, 1)
+	go func() {
+		collectErrChan <- source.Collect(context.Background(), nodeNames, outputRowPVCChan)
+	}()
+	var collected []string
+	for row := range outputRowPVCChan {
+		if row.Source != sourceExec || row.CapacityBytes.Value() != 1024000 || row.UsedBytes.Value() != 256000 || row.Inodes != 1000 || row.PercentageIUsed != 10 {
+			t.Fatalf("unexpected row: %+v", row)
+		}
+		collected = append(collected, row.PodName+":"+row.PVName)
+	}
+	sort.Strings(collected)
+	if want := "db-0:pvc-db,web-0:pvc-uploads,web-1:pvc-uploads"; strings.Join(collected, ",") != want {
+		t.Fatalf("collected %v, want %s", collected, want)
+	}
+
+	// the distroless container fails its node with a clear error, the volume shared by web-0 and web-1 is measured once,
+	// and the unresolved claims of node-1 are skipped without failing it
+	var nodeCollectionErr *NodeCollectionError
+	if err := <-collectErrChan; !errors.As(err, &nodeCollectionErr) || !nodeCollectionErr.IsPartial() || len(nodeCollectionErr.FailedNodes) != 1 || nodeCollectionErr.FailedNodes[0].NodeName != "node-2" || !strings.Contains(nodeCollectionErr.FailedNodes[0].Message, "df is not available in container 'distroless' of pod 'team-b/static-0'") {
+		t.Fatalf("expected node-2 to fail because df is missing, got %v", err)
+	}
+	uploadsCommands := 0
+	for _, command := range executor.commands {
+		if strings.Contains(command, "/srv/uploads") {
+			uploadsCommands++
+		}
+	}
+	if uploadsCommands != 2 {
+		t.Fatalf("expected df -kP and df -iP to run once for uploads, got %v", executor.commands)
+	}
+}
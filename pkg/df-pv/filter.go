@@ -0,0 +1,124 @@
+package df_pv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/text"
+)
+
+const (
+	severityRed    = "red"
+	severityYellow = "yellow"
+	severityGreen  = "green"
+)
+
+var availableSeverities = []string{severityRed, severityYellow, severityGreen}
+
+var colorToSeverity = map[text.Color]string{
+	text.FgRed:    severityRed,
+	text.FgYellow: severityYellow,
+	text.FgGreen:  severityGreen,
+}
+
+// RowFilter selects which output rows are printed; a row matches when either its byte or inode usage matches
+type RowFilter struct {
+	Severities map[string]struct{}
+	MinUsed    float64
+	MaxUsed    float64
+	Thresholds Thresholds
+}
+
+// NewRowFilter builds a row filter from the severity, min-used and max-used flags; severities are judged against the given thresholds
+func NewRowFilter(severity string, minUsed float64, maxUsed float64, thresholds Thresholds) (*RowFilter, error) {
+	severities, err := parseSeverities(severity)
+	if err != nil {
+		return nil, err
+	}
+	if minUsed < 0 || minUsed > 100 {
+		return nil, fmt.Errorf("min-used must be between 0 and 100, got %v", minUsed)
+	}
+	if maxUsed < 0 || maxUsed > 100 {
+		return nil, fmt.Errorf("max-used must be between 0 and 100, got %v", maxUsed)
+	}
+	if minUsed > maxUsed {
+		return nil, fmt.Errorf("min-used (%v) cannot be greater than max-used (%v)", minUsed, maxUsed)
+	}
+	return &RowFilter{
+		Severities: severities,
+		MinUsed:    minUsed,
+		MaxUsed:    maxUsed,
+		Thresholds: thresholds,
+	}, nil
+}
+
+func parseSeverities(severity string) (map[string]struct{}, error) {
+	if strings.TrimSpace(severity) == "" {
+		return nil, nil
+	}
+	severities := make(map[string]struct{})
+	for _, name := range strings.Split(severity, ",") {
+		normalizedName := strings.TrimSpace(strings.ToLower(name))
+		valid := false
+		for _, availableSeverity := range availableSeverities {
+			if normalizedName == availableSeverity {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown severity %q; available severities: %s", name, strings.Join(availableSeverities, ", "))
+		}
+		severities[normalizedName] = struct{}{}
+	}
+	return severities, nil
+}
+
+// IsActive reports whether the filter excludes anything at all
+func (f *RowFilter) IsActive() bool {
+	return f != nil && (0 < len(f.Severities) || f.MinUsed > 0 || f.MaxUsed < 100)
+}
+
+// Matches reports whether a row passes the filter
+func (f *RowFilter) Matches(row *OutputRowPVC) bool {
+	if !f.IsActive() {
+		return true
+	}
+	// ignored volumes are out of every threshold check, --min-used and --max-used included
+	if row.Ignored {
+		return false
+	}
+	thresholds := row.EffectiveThresholds(f.Thresholds)
+	return f.matchesPercentage(row.PercentageUsed, thresholds.Bytes) || f.matchesPercentage(row.PercentageIUsed, thresholds.Inodes)
+}
+
+func (f *RowFilter) matchesPercentage(percentageUsed float64, threshold Threshold) bool {
+	// volumes that do not report capacity or inodes have no meaningful percentage
+	if math.IsNaN(percentageUsed) || math.IsInf(percentageUsed, 0) {
+		return false
+	}
+	if percentageUsed < f.MinUsed || percentageUsed > f.MaxUsed {
+		return false
+	}
+	if 0 < len(f.Severities) {
+		if _, ok := f.Severities[colorToSeverity[threshold.Color(percentageUsed)]]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterOutputRows returns the rows that match the filter
+func FilterOutputRows(sliceOfOutputRowPVC []*OutputRowPVC, filter *RowFilter) []*OutputRowPVC {
+	if !filter.IsActive() {
+		return sliceOfOutputRowPVC
+	}
+	var filtered []*OutputRowPVC
+	for _, row := range sliceOfOutputRowPVC {
+		if filter.Matches(row) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,89 @@
+package df_pv
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterOutputRows(t *testing.T) {
+	rows := []*OutputRowPVC{
+		{PVCName: "low", PercentageUsed: 10, PercentageIUsed: 1},
+		{PVCName: "mid", PercentageUsed: 50, PercentageIUsed: 1},
+		{PVCName: "high", PercentageUsed: 90, PercentageIUsed: 1},
+		{PVCName: "inodes-high", PercentageUsed: 30, PercentageIUsed: 95},
+		{PVCName: "no-inodes", PercentageUsed: 30, PercentageIUsed: math.NaN()},
+	}
+
+	tests := []struct {
+		name     string
+		severity string
+		minUsed  float64
+		maxUsed  float64
+		want     []string
+	}{
+		{
+			name:    "inactive filter keeps everything",
+			maxUsed: 100,
+			want:    []string{"low", "mid", "high", "inodes-high", "no-inodes"},
+		},
+		{
+			name:     "red matches byte or inode usage",
+			severity: "red",
+			maxUsed:  100,
+			want:     []string{"high", "inodes-high"},
+		},
+		{
+			name:     "multiple severities",
+			severity: "RED, yellow",
+			maxUsed:  100,
+			want:     []string{"mid", "high", "inodes-high", "no-inodes"},
+		},
+		{
+			name:    "min-used",
+			minUsed: 80,
+			maxUsed: 100,
+			want:    []string{"high", "inodes-high"},
+		},
+		{
+			name:    "max-used",
+			maxUsed: 5,
+			want:    []string{"low", "mid", "high"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewRowFilter(tt.severity, tt.minUsed, tt.maxUsed, DefaultThresholds)
+			if err != nil {
+				t.Fatalf("NewRowFilter returned unexpected error: %v", err)
+			}
+			got := pvcNames(FilterOutputRows(rows, filter))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("FilterOutputRows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRowFilterRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		severity   string
+		minUsed    float64
+		maxUsed    float64
+		errorMatch string
+	}{
+		{severity: "red,blue", maxUsed: 100, errorMatch: `unknown severity "blue"`},
+		{minUsed: -1, maxUsed: 100, errorMatch: "min-used must be between 0 and 100"},
+		{maxUsed: 101, errorMatch: "max-used must be between 0 and 100"},
+		{minUsed: 80, maxUsed: 10, errorMatch: "cannot be greater than max-used"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRowFilter(tt.severity, tt.minUsed, tt.maxUsed, DefaultThresholds)
+		if err == nil || !strings.Contains(err.Error(), tt.errorMatch) {
+			t.Fatalf("NewRowFilter(%q, %v, %v) error = %v, want substring %q", tt.severity, tt.minUsed, tt.maxUsed, err, tt.errorMatch)
+		}
+	}
+}
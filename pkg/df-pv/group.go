@@ -0,0 +1,156 @@
+package df_pv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// --group-by values
+const (
+	groupByNamespace    = "namespace"
+	groupByNode         = "node"
+	groupByStorageClass = "storageclass"
+	groupByOwner        = "owner"
+)
+
+// groupKeys maps each --group-by value to the key a row is grouped by
+var groupKeys = map[string]func(row *OutputRowPVC) string{
+	groupByNamespace: func(row *OutputRowPVC) string { return row.Namespace },
+	groupByNode:      nodeGroupKey,
+	groupByStorageClass: func(row *OutputRowPVC) string {
+		if row.StorageClass == "" {
+			return "<none>"
+		}
+		return row.StorageClass
+	},
+	groupByOwner: func(row *OutputRowPVC) string {
+		if row.OwnerKind == "" {
+			return row.Namespace + "/<none>"
+		}
+		return row.Namespace + "/" + row.OwnerKind + "/" + row.OwnerName
+	},
+}
+
+// nodeGroupKey groups a volume mounted on several nodes under the sorted, comma separated list of those nodes, so
+// that it is counted once and node subtotals add up to the total
+func nodeGroupKey(row *OutputRowPVC) string {
+	nodeNames := strings.Split(row.NodeName, ",")
+	sort.Strings(nodeNames)
+	return strings.Join(nodeNames, ",")
+}
+
+var availableGroupBy = []string{groupByNamespace, groupByNode, groupByStorageClass, groupByOwner}
+
+// groupHeaders are the headers of the group column in --summary tables
+var groupHeaders = map[string]string{
+	groupByNamespace:    "Namespace",
+	groupByNode:         "Node Name",
+	groupByStorageClass: "Storage Class",
+	groupByOwner:        "Owner",
+}
+
+// summaryColumnOrder lists the columns that can be added up, i.e. the ones shown by --summary
+var summaryColumnOrder = []string{"size", "used", "available", "%used", "iused", "ifree", "%iused"}
+
+// parseGroupBy validates the --group-by flag; empty means no grouping
+func parseGroupBy(groupBy string) (string, error) {
+	groupBy = strings.TrimSpace(strings.ToLower(groupBy))
+	if groupBy == "" {
+		return "", nil
+	}
+	if _, ok := groupKeys[groupBy]; !ok {
+		return "", fmt.Errorf("unknown group-by %q; valid values are [%s]", groupBy, strings.Join(availableGroupBy, ", "))
+	}
+	return groupBy, nil
+}
+
+// OutputRowGroup is a set of rows sharing the same group key along with their subtotal; Volumes counts every
+// volume once even when the rows are per mount
+type OutputRowGroup struct {
+	Key      string
+	Rows     []*OutputRowPVC
+	Volumes  int
+	Subtotal *OutputRowPVC
+}
+
+// GroupOutputRows groups the rows by the given --group-by value, keeping the order of the rows within each group;
+// groups are ordered by key
+func GroupOutputRows(sliceOfOutputRowPVC []*OutputRowPVC, groupBy string) []*OutputRowGroup {
+	groupKey := groupKeys[groupBy]
+	var groups []*OutputRowGroup
+	groupsByKey := make(map[string]*OutputRowGroup)
+	for _, row := range sliceOfOutputRowPVC {
+		key := groupKey(row)
+		group, ok := groupsByKey[key]
+		if !ok {
+			group = &OutputRowGroup{Key: key}
+			groupsByKey[key] = group
+			groups = append(groups, group)
+		}
+		group.Rows = append(group.Rows, row)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	for _, group := range groups {
+		group.Volumes = len(uniqueVolumes(group.Rows))
+		group.Subtotal = SumOutputRows(group.Rows)
+	}
+	return groups
+}
+
+// SumOutputRows adds up the bytes and inodes of the volumes, counting a volume mounted by several pods once, and
+// recomputes the percentages; the capacity of volumes with unknown usage is added to the size, but not to the
+// percentages. Descriptive fields are kept when all rows agree on them
+func SumOutputRows(sliceOfOutputRowPVC []*OutputRowPVC) *OutputRowPVC {
+	var capacityBytes, knownCapacityBytes, usedBytes, availableBytes int64
+	total := &OutputRowPVC{UsageUnknown: 0 < len(sliceOfOutputRowPVC)}
+	for i, row := range uniqueVolumes(sliceOfOutputRowPVC) {
+		capacityBytes += quantityValue(row.CapacityBytes)
+		if !row.UsageUnknown {
+			total.UsageUnknown = false
+			knownCapacityBytes += quantityValue(row.CapacityBytes)
+			usedBytes += quantityValue(row.UsedBytes)
+			availableBytes += quantityValue(row.AvailableBytes)
+			total.Inodes += row.Inodes
+			total.InodesUsed += row.InodesUsed
+			total.InodesFree += row.InodesFree
+		}
+		if i == 0 {
+			total.Namespace, total.NodeName, total.StorageClass = row.Namespace, row.NodeName, row.StorageClass
+			total.OwnerKind, total.OwnerName = row.OwnerKind, row.OwnerName
+			continue
+		}
+		total.Namespace = commonValue(total.Namespace, row.Namespace)
+		total.NodeName = commonValue(total.NodeName, row.NodeName)
+		total.StorageClass = commonValue(total.StorageClass, row.StorageClass)
+		if total.OwnerKind != row.OwnerKind || total.OwnerName != row.OwnerName {
+			total.OwnerKind, total.OwnerName = "", ""
+		}
+	}
+	total.CapacityBytes = resource.NewQuantity(capacityBytes, resource.BinarySI)
+	total.UsedBytes = resource.NewQuantity(usedBytes, resource.BinarySI)
+	total.AvailableBytes = resource.NewQuantity(availableBytes, resource.BinarySI)
+	total.PercentageUsed = (float64(usedBytes) / float64(knownCapacityBytes)) * 100.0
+	total.PercentageIUsed = (float64(total.InodesUsed) / float64(total.Inodes)) * 100.0
+	return total
+}
+
+func commonValue(current string, value string) string {
+	if current != value {
+		return ""
+	}
+	return current
+}
+
+// SortOutputRowsByGroup reorders the rows so that the rows of each group are adjacent, keeping the current
+// order within each group
+func SortOutputRowsByGroup(sliceOfOutputRowPVC []*OutputRowPVC, groupBy string) {
+	groupKey := groupKeys[groupBy]
+	sort.SliceStable(sliceOfOutputRowPVC, func(i, j int) bool {
+		return groupKey(sliceOfOutputRowPVC[i]) < groupKey(sliceOfOutputRowPVC[j])
+	})
+}
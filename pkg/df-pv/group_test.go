@@ -0,0 +1,115 @@
+package df_pv
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupOutputRowsByOwner(t *testing.T) {
+	rows := []*OutputRowPVC{
+		newTestRow("ns", "data-db-0", 100, 50),
+		newTestRow("ns", "cache", 100, 10),
+		newTestRow("ns", "data-db-1", 300, 50),
+	}
+	rows[0].OwnerKind, rows[0].OwnerName = "StatefulSet", "db"
+	rows[1].OwnerKind, rows[1].OwnerName = "Deployment", "web"
+	rows[2].OwnerKind, rows[2].OwnerName = "StatefulSet", "db"
+
+	groups := GroupOutputRows(rows, groupByOwner)
+	if len(groups) != 2 || groups[0].Key != "ns/Deployment/web" || groups[1].Key != "ns/StatefulSet/db" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+	if got := pvcNames(groups[1].Rows); !reflect.DeepEqual(got, []string{"data-db-0", "data-db-1"}) {
+		t.Fatalf("rows of the StatefulSet group = %v", got)
+	}
+	subtotal := groups[1].Subtotal
+	if quantityValue(subtotal.CapacityBytes) != 400 || quantityValue(subtotal.UsedBytes) != 100 || quantityValue(subtotal.AvailableBytes) != 300 {
+		t.Fatalf("unexpected subtotal bytes: %+v", subtotal)
+	}
+	if subtotal.PercentageUsed != 25 || subtotal.Inodes != 200 || subtotal.PercentageIUsed != 10 {
+		t.Fatalf("unexpected subtotal percentages or inodes: %+v", subtotal)
+	}
+	if subtotal.OwnerKind != "StatefulSet" || subtotal.OwnerName != "db" || subtotal.Namespace != "ns" || subtotal.PVCName != "" {
+		t.Fatalf("unexpected subtotal descriptive fields: %+v", subtotal)
+	}
+
+	SortOutputRowsByGroup(rows, groupByOwner)
+	if got := pvcNames(rows); !reflect.DeepEqual(got, []string{"cache", "data-db-0", "data-db-1"}) {
+		t.Fatalf("SortOutputRowsByGroup = %v", got)
+	}
+}
+
+func TestParseGroupByRejectsUnknownValue(t *testing.T) {
+	_, err := parseGroupBy("team")
+	if err == nil || !strings.Contains(err.Error(), `unknown group-by "team"`) {
+		t.Fatalf("parseGroupBy error = %v, want unknown-group-by message", err)
+	}
+}
+
+func TestGroupKeys(t *testing.T) {
+	row := &OutputRowPVC{Namespace: "ns", NodeName: "node-a"}
+	for groupBy, want := range map[string]string{groupByNamespace: "ns", groupByNode: "node-a", groupByStorageClass: "<none>", groupByOwner: "ns/<none>"} {
+		if got := groupKeys[groupBy](row); got != want {
+			t.Fatalf("group key for %s = %q, want %q", groupBy, got, want)
+		}
+	}
+}
+
+func TestPrintStructuredEmitsNestedGroups(t *testing.T) {
+	rows := []*OutputRowPVC{
+		newTestRow("ns", "a", 100, 50),
+		newTestRow("ns", "b", 300, 50),
+	}
+	rows[1].Namespace = "other"
+	rows[0].PercentageIUsed = math.NaN()
+
+	for _, tt := range []struct {
+		summary   bool
+		wantItems int
+	}{{summary: false, wantItems: 1}, {summary: true, wantItems: 0}} {
+		list := NewVolumeUsageList(rows, "", time.Now())
+		list.SetGroups(GroupOutputRows(rows, groupByNamespace), groupByNamespace, tt.summary)
+
+		var buf bytes.Buffer
+		if err := PrintStructured(&buf, list, outputFormatJSON); err != nil {
+			t.Fatalf("PrintStructured returned unexpected error: %v", err)
+		}
+		var got struct {
+			Items   []json.RawMessage `json:"items"`
+			GroupBy string            `json:"groupBy"`
+			Groups  []struct {
+				Key      string            `json:"key"`
+				Subtotal VolumeUsageTotal  `json:"subtotal"`
+				Items    []json.RawMessage `json:"items"`
+			} `json:"groups"`
+			Total VolumeUsageTotal `json:"total"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("output is not valid json: %v\n%s", err, buf.String())
+		}
+		if got.GroupBy != groupByNamespace || len(got.Groups) != 2 || got.Groups[0].Key != "ns" || got.Groups[1].Key != "other" {
+			t.Fatalf("unexpected groups (summary=%t): %s", tt.summary, buf.String())
+		}
+		if len(got.Groups[0].Items) != tt.wantItems || (tt.summary && len(got.Items) != 0) || (!tt.summary && len(got.Items) != 2) {
+			t.Fatalf("unexpected items (summary=%t): %s", tt.summary, buf.String())
+		}
+		if got.Groups[1].Subtotal.Volumes != 1 || got.Groups[1].Subtotal.CapacityBytesValue != 300 {
+			t.Fatalf("unexpected subtotal: %+v", got.Groups[1].Subtotal)
+		}
+		if got.Total.Volumes != 2 || got.Total.UsedBytesValue != 100 || got.Total.PercentageUsed == nil || *got.Total.PercentageUsed != 25 {
+			t.Fatalf("unexpected total: %+v", got.Total)
+		}
+	}
+}
+
+func TestRunRootCommandRejectsSummaryWithDelimitedOutput(t *testing.T) {
+	err := runRootCommand(&flagpole{output: "csv", summary: true, maxUsed: 100})
+	if err == nil || !strings.Contains(err.Error(), "summary is not supported with csv output") {
+		t.Fatalf("runRootCommand error = %v, want summary-not-supported message", err)
+	}
+}
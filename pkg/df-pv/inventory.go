@@ -0,0 +1,126 @@
+package df_pv
+
+import (
+	"context"
+	"math"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// unknownUsage is shown in the usage columns of volumes whose usage could not be queried
+const unknownUsage = "unknown"
+
+// orphanColumnOrder are the default columns of --orphans; the pvc and namespace are those of the former claim
+var orphanColumnOrder = []string{"pv", "status", "pvc", "namespace", "storageclass", "reclaimpolicy", "size", "age"}
+
+// UnmountedOutputRows returns a row for every PVC selected by namespaceFilter that is not among mountedRows, e.g.
+// Pending claims or claims of workloads scaled to zero; their usage is unknown
+func (idx *VolumeClaimIndex) UnmountedOutputRows(ctx context.Context, namespaceFilter *NamespaceFilter, mountedRows []*OutputRowPVC) ([]*OutputRowPVC, error) {
+	if err := idx.load(ctx); err != nil {
+		return nil, err
+	}
+	if idx.withoutClaims {
+		return nil, errors.New("the PVCs were not captured")
+	}
+	mounted := make(map[string]bool, len(mountedRows))
+	for _, row := range mountedRows {
+		mounted[pvcKey(row.Namespace, row.PVCName)] = true
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	for key, pvc := range idx.pvcs {
+		if mounted[key] || !namespaceFilter.Matches(pvc.Namespace) {
+			continue
+		}
+		row := &OutputRowPVC{
+			Namespace:       pvc.Namespace,
+			PVCName:         pvc.Name,
+			PVName:          pvc.Spec.VolumeName,
+			UsageUnknown:    true,
+			PercentageUsed:  math.NaN(),
+			PercentageIUsed: math.NaN(),
+		}
+		EnrichOutputRowFromClaim(row, pvc, idx.pvs[pvc.Spec.VolumeName])
+		// the provisioned capacity once bound, the requested one while pending
+		if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			row.CapacityBytes = &capacity
+		} else {
+			row.CapacityBytes = row.RequestedBytes
+		}
+		row.ThresholdOverrides, row.Ignored = ParseVolumeAnnotations(key, pvc.Annotations)
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, row)
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+// OrphanedOutputRows returns a row for every Released or Available PV whose claim does not exist; with a namespace
+// selection, only the PVs last claimed in one of the selected namespaces are returned
+func (idx *VolumeClaimIndex) OrphanedOutputRows(ctx context.Context, namespaceFilter *NamespaceFilter) ([]*OutputRowPVC, error) {
+	if err := idx.load(ctx); err != nil {
+		return nil, err
+	}
+	if idx.withoutClaims {
+		return nil, errors.New("the PVCs were not captured")
+	}
+	if idx.pvsErr != nil {
+		return nil, idx.pvsErr
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	for _, pv := range idx.pvs {
+		if pv.Status.Phase != corev1.VolumeReleased && pv.Status.Phase != corev1.VolumeAvailable {
+			continue
+		}
+		claimRef := pv.Spec.ClaimRef
+		if claimRef != nil {
+			// a claim recreated with the same name does not own the PV
+			pvc, ok := idx.pvcs[pvcKey(claimRef.Namespace, claimRef.Name)]
+			if ok && (claimRef.UID == "" || claimRef.UID == pvc.UID) {
+				continue
+			}
+		}
+		if !namespaceFilter.IsAllNamespaces() && (claimRef == nil || !namespaceFilter.Matches(claimRef.Namespace)) {
+			continue
+		}
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, newOrphanedOutputRow(pv))
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+func newOrphanedOutputRow(pv *corev1.PersistentVolume) *OutputRowPVC {
+	row := &OutputRowPVC{
+		PVName:          pv.Name,
+		Phase:           string(pv.Status.Phase),
+		StorageClass:    pv.Spec.StorageClassName,
+		ReclaimPolicy:   string(pv.Spec.PersistentVolumeReclaimPolicy),
+		UsageUnknown:    true,
+		PercentageUsed:  math.NaN(),
+		PercentageIUsed: math.NaN(),
+	}
+	if pv.Spec.ClaimRef != nil {
+		row.Namespace, row.PVCName = pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name
+	}
+	for _, accessMode := range pv.Spec.AccessModes {
+		row.AccessModes = append(row.AccessModes, string(accessMode))
+	}
+	if pv.Spec.VolumeMode != nil {
+		row.VolumeMode = string(*pv.Spec.VolumeMode)
+	}
+	if pv.Spec.CSI != nil {
+		row.CSIDriver = pv.Spec.CSI.Driver
+		row.VolumeHandle = pv.Spec.CSI.VolumeHandle
+	}
+	if capacity, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+		row.CapacityBytes = &capacity
+	}
+	if !pv.CreationTimestamp.IsZero() {
+		creationTimestamp := pv.CreationTimestamp
+		row.CreationTimestamp = &creationTimestamp
+	}
+	return row
+}
@@ -0,0 +1,137 @@
+package df_pv
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newOrphanedPV(name string, phase corev1.PersistentVolumePhase, claimRef *corev1.ObjectReference) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+			ClaimRef:                      claimRef,
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: phase},
+	}
+}
+
+func TestUnmountedOutputRows(t *testing.T) {
+	mounted := newBoundPVC("ns", "mounted", "pv-mounted")
+	scaledDown := newBoundPVC("ns", "scaled-down", "pv-scaled-down")
+	scaledDown.Status.Phase = corev1.ClaimBound
+	scaledDown.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")}
+	pending := newBoundPVC("ns", "pending", "")
+	pending.Status.Phase = corev1.ClaimPending
+	pending.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	excluded := newBoundPVC("other", "excluded", "pv-excluded")
+	clientset := newFakeClusterClientset(t, &fakeCluster{pvcs: []corev1.PersistentVolumeClaim{mounted, scaledDown, pending, excluded}})
+
+	namespaceFilter, err := NewNamespaceFilter("ns", nil)
+	if err != nil {
+		t.Fatalf("NewNamespaceFilter returned unexpected error: %v", err)
+	}
+	mountedRows := []*OutputRowPVC{{Namespace: "ns", PVCName: "mounted", PVName: "pv-mounted"}}
+	rows, err := NewVolumeClaimIndex(clientset, "").UnmountedOutputRows(context.Background(), namespaceFilter, mountedRows)
+	if err != nil {
+		t.Fatalf("UnmountedOutputRows returned unexpected error: %v", err)
+	}
+	SortOutputRows(rows, defaultSortOrder, false)
+	if got := pvcNames(rows); len(got) != 2 || got[0] != "pending" || got[1] != "scaled-down" {
+		t.Fatalf("unmounted PVCs = %v, want [pending scaled-down]", got)
+	}
+	if !rows[0].UsageUnknown || rows[0].Phase != "Pending" || rows[0].CapacityBytes.Value() != 10<<30 {
+		t.Fatalf("expected the pending claim with its requested capacity, got %+v", rows[0])
+	}
+	if rows[1].Phase != "Bound" || rows[1].CapacityBytes.Value() != 20<<30 {
+		t.Fatalf("expected the bound claim with its provisioned capacity, got %+v", rows[1])
+	}
+
+	output := captureStdout(t, func() {
+		_ = PrintUsingGoPretty(rows, true, "pvc,status,size,used,%used", DefaultThresholds)
+	})
+	for _, want := range []string{"Pending", "10Gi", unknownUsage} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("PrintUsingGoPretty output = %q, missing %q", output, want)
+		}
+	}
+}
+
+func TestUnmountedOutputRowsWithoutStorageRequest(t *testing.T) {
+	clientset := newFakeClusterClientset(t, &fakeCluster{pvcs: []corev1.PersistentVolumeClaim{newBoundPVC("ns", "static", "")}})
+
+	rows, err := NewVolumeClaimIndex(clientset, "").UnmountedOutputRows(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("UnmountedOutputRows returned unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].CapacityBytes != nil {
+		t.Fatalf("expected the claim without a capacity, got %+v", rows)
+	}
+
+	output := captureStdout(t, func() {
+		_ = PrintUsingGoPretty(rows, true, "pvc,size,used", DefaultThresholds)
+	})
+	if !strings.Contains(output, "static") {
+		t.Fatalf("PrintUsingGoPretty output = %q, missing the claim", output)
+	}
+	var buf bytes.Buffer
+	if err := PrintDelimited(&buf, rows, "pvc,size", ',', true); err != nil {
+		t.Fatalf("PrintDelimited returned unexpected error: %v", err)
+	}
+	if want := "static,\n"; buf.String() != want {
+		t.Fatalf("PrintDelimited output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestOrphanedOutputRows(t *testing.T) {
+	claim := newBoundPVC("ns", "data", "pv-bound")
+	claim.UID = "new"
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		pvcs: []corev1.PersistentVolumeClaim{claim},
+		pvs: []corev1.PersistentVolume{
+			newOrphanedPV("pv-bound", corev1.VolumeBound, &corev1.ObjectReference{Namespace: "ns", Name: "data", UID: "new"}),
+			newOrphanedPV("pv-released", corev1.VolumeReleased, &corev1.ObjectReference{Namespace: "ns", Name: "data", UID: "old"}),
+			newOrphanedPV("pv-available", corev1.VolumeAvailable, nil),
+		},
+	})
+
+	rows, err := NewVolumeClaimIndex(clientset, "").OrphanedOutputRows(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("OrphanedOutputRows returned unexpected error: %v", err)
+	}
+	SortOutputRows(rows, []string{"pv"}, false)
+	if len(rows) != 2 || rows[0].PVName != "pv-available" || rows[1].PVName != "pv-released" {
+		t.Fatalf("unexpected orphaned PVs: %+v", rows)
+	}
+	if released := rows[1]; released.PVCName != "data" || released.Phase != "Released" || released.ReclaimPolicy != "Retain" || released.CapacityBytes.Value() != 5<<30 {
+		t.Fatalf("unexpected released PV row: %+v", released)
+	}
+
+	total := SumOutputRows(rows)
+	if total.CapacityBytes.Value() != 10<<30 || !total.UsageUnknown {
+		t.Fatalf("expected the total capacity of the orphans with unknown usage, got %+v", total)
+	}
+}
+
+func TestFlagpoleParseForInventory(t *testing.T) {
+	flags := &flagpole{all: true, maxUsed: 100, warnThreshold: 25, criticalThreshold: 75, inodeWarnThreshold: 25, inodeCriticalThreshold: 75}
+	opts, err := flags.parse()
+	if err != nil {
+		t.Fatalf("parse returned unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(opts.columns, ",%used,status") {
+		t.Fatalf("all columns = %q, want default columns followed by status", opts.columns)
+	}
+
+	flags.orphans = true
+	if _, err := flags.parse(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Fatalf("parse error = %v, want an error combining all and orphans", err)
+	}
+}
@@ -0,0 +1,137 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// defaultKubeletPort is the kubelet port assumed when a node does not report its own
+const defaultKubeletPort = 10250
+
+// KubeletOptions controls whether and how the kubelets are queried directly instead of through the API server proxy
+type KubeletOptions struct {
+	// Direct queries the kubelets directly
+	Direct bool
+	// CertificateAuthority is a file with the CA bundle verifying the kubelet serving certificates; the CA of the
+	// kubeconfig is used when empty
+	CertificateAuthority string
+	// InsecureSkipTLSVerify does not verify the kubelet serving certificates
+	InsecureSkipTLSVerify bool
+}
+
+func (opts KubeletOptions) validate() error {
+	if !opts.Direct && (opts.CertificateAuthority != "" || opts.InsecureSkipTLSVerify) {
+		return fmt.Errorf("kubelet-certificate-authority and kubelet-insecure-skip-tls-verify need the %s source or kubelet-direct", sourceKubelet)
+	}
+	if opts.CertificateAuthority != "" && opts.InsecureSkipTLSVerify {
+		return fmt.Errorf("kubelet-certificate-authority and kubelet-insecure-skip-tls-verify cannot be combined")
+	}
+	return nil
+}
+
+// KubeletClient queries the kubelets of the nodes directly, authenticating with the credentials of the kubeconfig
+type KubeletClient struct {
+	restClients map[string]*rest.RESTClient
+	nodeErrs    map[string]error
+}
+
+// NewKubeletClient creates a client for the kubelets of the given nodes; a node without a usable address fails only
+// when it is queried
+func NewKubeletClient(kubeConfig *rest.Config, options KubeletOptions, nodes []corev1.Node) (*KubeletClient, error) {
+	config := rest.CopyConfig(kubeConfig)
+	// the TLS server name and CA of the kubeconfig are the API server's, and the kubelet serves a different certificate
+	config.TLSClientConfig.ServerName = ""
+	if options.CertificateAuthority != "" {
+		config.TLSClientConfig.CAFile = options.CertificateAuthority
+		config.TLSClientConfig.CAData = nil
+	}
+	if options.InsecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+	config.APIPath = ""
+	config.ContentConfig = rest.ContentConfig{
+		GroupVersion:         &schema.GroupVersion{},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+	}
+	// one transport for all the kubelets, so that connections and credentials are shared
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create the kubelet client")
+	}
+
+	client := &KubeletClient{
+		restClients: make(map[string]*rest.RESTClient, len(nodes)),
+		nodeErrs:    make(map[string]error),
+	}
+	for i := range nodes {
+		node := &nodes[i]
+		endpoint, err := KubeletEndpoint(node)
+		if err != nil {
+			client.nodeErrs[node.Name] = err
+			continue
+		}
+		nodeConfig := rest.CopyConfig(config)
+		nodeConfig.Host = endpoint
+		restClient, err := rest.RESTClientForConfigAndClient(nodeConfig, httpClient)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create the kubelet client of node '%s'", node.Name)
+		}
+		client.restClients[node.Name] = restClient
+	}
+	return client, nil
+}
+
+// KubeletEndpoint returns the https URL of the kubelet of a node, from its InternalIP and kubelet port
+func KubeletEndpoint(node *corev1.Node) (string, error) {
+	port := int(node.Status.DaemonEndpoints.KubeletEndpoint.Port)
+	if port == 0 {
+		port = defaultKubeletPort
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP && address.Address != "" {
+			return "https://" + net.JoinHostPort(address.Address, strconv.Itoa(port)), nil
+		}
+	}
+	return "", fmt.Errorf("node '%s' has no InternalIP to reach its kubelet at", node.Name)
+}
+
+// Get gets path from the kubelet of a node; like requests through the node proxy, failed requests return the
+// status error of the response
+func (c *KubeletClient) Get(ctx context.Context, nodeName string, path string) ([]byte, error) {
+	restClient, ok := c.restClients[nodeName]
+	if !ok {
+		if err, ok := c.nodeErrs[nodeName]; ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("node '%s' was not listed, so its kubelet cannot be reached", nodeName)
+	}
+	return restClient.Get().AbsPath("/", path).Do(ctx).Raw()
+}
+
+// withKubeletClient connects queryOptions to the kubelets of the cluster for the kubelet source
+func (flags *flagpole) withKubeletClient(ctx context.Context, clientset kubernetes.Interface, queryOptions NodeQueryOptions) (NodeQueryOptions, error) {
+	if !queryOptions.Kubelet.Direct {
+		return queryOptions, nil
+	}
+	kubeConfig, err := GetKubeConfigFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	if err != nil {
+		return queryOptions, errors.Wrapf(err, "unable to build config from flags")
+	}
+	nodes, err := ListNodes(ctx, clientset)
+	if err != nil {
+		return queryOptions, errors.Wrapf(err, "failed to list nodes to find their kubelets")
+	}
+	queryOptions.kubeletClient, err = NewKubeletClient(kubeConfig, queryOptions.Kubelet, nodes.Items)
+	return queryOptions, err
+}
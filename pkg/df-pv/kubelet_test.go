@@ -0,0 +1,146 @@
+package df_pv
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func newNodeWithKubelet(name string, internalIP string, port int32) corev1.Node {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.DaemonEndpoints.KubeletEndpoint.Port = port
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeHostName, Address: name}}
+	if internalIP != "" {
+		node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: internalIP})
+	}
+	return node
+}
+
+func TestKubeletEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		node    corev1.Node
+		want    string
+		wantErr string
+	}{
+		{node: newNodeWithKubelet("node-1", "10.0.0.1", 10250), want: "https://10.0.0.1:10250"},
+		{node: newNodeWithKubelet("node-2", "10.0.0.2", 0), want: "https://10.0.0.2:10250"},
+		{node: newNodeWithKubelet("node-3", "fd00::3", 11250), want: "https://[fd00::3]:11250"},
+		{node: newNodeWithKubelet("node-4", "", 10250), wantErr: "no InternalIP"},
+	} {
+		got, err := KubeletEndpoint(&tc.node)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("KubeletEndpoint(%s) error = %v, want %q", tc.node.Name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("KubeletEndpoint(%s) = %q, %v, want %q", tc.node.Name, got, err, tc.want)
+		}
+	}
+}
+
+func TestKubeletOptionsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		options KubeletOptions
+		wantErr string
+	}{
+		{options: KubeletOptions{}},
+		{options: KubeletOptions{Direct: true, CertificateAuthority: "ca.crt"}},
+		{options: KubeletOptions{Direct: true, InsecureSkipTLSVerify: true}},
+		{options: KubeletOptions{InsecureSkipTLSVerify: true}, wantErr: "need the kubelet source or kubelet-direct"},
+		{options: KubeletOptions{Direct: true, CertificateAuthority: "ca.crt", InsecureSkipTLSVerify: true}, wantErr: "cannot be combined"},
+	} {
+		err := tc.options.validate()
+		if (tc.wantErr == "" && err != nil) || (tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr))) {
+			t.Fatalf("%+v.validate() = %v, want %q", tc.options, err, tc.wantErr)
+		}
+	}
+}
+
+func TestProduceOutputRowsFromKubeletsDirectly(t *testing.T) {
+	summary := `{"pods":[{"podRef":{"name":"db-0","namespace":"team-a"},"volume":[{"name":"data","capacityBytes":100,"usedBytes":10,"availableBytes":90,"pvcRef":{"name":"data-db-0","namespace":"team-a"}}]}]}`
+	kubelet := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer kubelet-reader" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/stats/summary" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(summary))
+	}))
+	t.Cleanup(kubelet.Close)
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(kubelet.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeletPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "kubelet-ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kubelet.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &fakeCluster{pvcs: []corev1.PersistentVolumeClaim{newBoundPVC("team-a", "data-db-0", "pvc-db")}}
+	clientset := newFakeClusterClientset(t, cluster)
+	nodes := []corev1.Node{newNodeWithKubelet("node-1", host, int32(kubeletPort)), newNodeWithKubelet("node-2", "", 10250)}
+	collect := func(kubeConfig *rest.Config, options KubeletOptions) ([]*OutputRowPVC, error) {
+		kubeletClient, err := NewKubeletClient(kubeConfig, options, nodes)
+		if err != nil {
+			t.Fatalf("NewKubeletClient returned unexpected error: %v", err)
+		}
+		outputRowPVCChan := make(chan *OutputRowPVC)
+		result := make(chan error, 1)
+		go func() {
+			result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{"node-1"}, NodeQueryOptions{kubeletClient: kubeletClient}, outputRowPVCChan)
+		}()
+		rows := ConsumeOutputRowsConcurrently(outputRowPVCChan)
+		return rows, <-result
+	}
+
+	// the CA of the kubeconfig is the API server's, so the kubelet certificate needs its own CA or no verification
+	kubeConfig := &rest.Config{BearerToken: "kubelet-reader", TLSClientConfig: rest.TLSClientConfig{ServerName: "kube-apiserver"}}
+	for _, options := range []KubeletOptions{{Direct: true, CertificateAuthority: caFile}, {Direct: true, InsecureSkipTLSVerify: true}} {
+		rows, err := collect(kubeConfig, options)
+		if err != nil || len(rows) != 1 || rows[0].PVName != "pvc-db" || rows[0].NodeName != "node-1" || rows[0].PodName != "db-0" {
+			t.Fatalf("collecting with %+v = %+v, %v, want the row of db-0", options, rows, err)
+		}
+	}
+	if _, err := collect(kubeConfig, KubeletOptions{Direct: true}); err == nil || !strings.Contains(err.Error(), "1 of 1 nodes") {
+		t.Fatalf("expected an unverified kubelet certificate to fail the node, got %v", err)
+	}
+	if _, err := collect(&rest.Config{BearerToken: "someone-else"}, KubeletOptions{Direct: true, InsecureSkipTLSVerify: true}); err == nil {
+		t.Fatalf("expected the kubelet to refuse other credentials")
+	}
+	for _, requestedPath := range cluster.requests() {
+		if strings.Contains(requestedPath, "/proxy/") {
+			t.Fatalf("expected the API server node proxy to be bypassed, got a request to %s", requestedPath)
+		}
+	}
+
+	kubeletClient, err := NewKubeletClient(kubeConfig, KubeletOptions{Direct: true, InsecureSkipTLSVerify: true}, nodes)
+	if err != nil {
+		t.Fatalf("NewKubeletClient returned unexpected error: %v", err)
+	}
+	if _, err := kubeletClient.Get(context.Background(), "node-2", kubeletStatsSummaryPath); err == nil || !strings.Contains(err.Error(), "no InternalIP") {
+		t.Fatalf("expected node-2 to fail without an InternalIP, got %v", err)
+	}
+	if _, err := kubeletClient.Get(context.Background(), "node-3", kubeletStatsSummaryPath); err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Fatalf("expected an unlisted node to fail, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespacedKey identifies a namespaced object among the objects of its kind, e.g. a pod, by namespace/name
+func namespacedKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// NamespaceFilter decides which namespaces are in scope for a request
+type NamespaceFilter struct {
+	// Include is the set of namespaces to show; nil means all namespaces
+	Include map[string]struct{}
+	// Exclude holds glob or regular expression patterns of namespaces to hide
+	Exclude []*namespacePattern
+}
+
+// namespacePattern is either a glob (e.g. "ci-*") or a regular expression enclosed in slashes (e.g. "/^ci-[0-9]+$/")
+type namespacePattern struct {
+	raw    string
+	glob   string
+	regexp *regexp.Regexp
+}
+
+// NewNamespaceFilter builds a namespace filter from a comma separated list of namespaces and exclusion patterns
+func NewNamespaceFilter(namespaces string, excludePatterns []string) (*NamespaceFilter, error) {
+	filter := &NamespaceFilter{}
+	for _, ns := range strings.Split(namespaces, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if filter.Include == nil {
+			filter.Include = make(map[string]struct{})
+		}
+		filter.Include[ns] = struct{}{}
+	}
+	for _, rawPattern := range excludePatterns {
+		pattern, err := parseNamespacePattern(rawPattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.Exclude = append(filter.Exclude, pattern)
+	}
+	return filter, nil
+}
+
+func parseNamespacePattern(rawPattern string) (*namespacePattern, error) {
+	trimmed := strings.TrimSpace(rawPattern)
+	if trimmed == "" {
+		return nil, fmt.Errorf("exclude-namespace pattern cannot be empty")
+	}
+	if 2 < len(trimmed) && strings.HasPrefix(trimmed, "/") && strings.HasSuffix(trimmed, "/") {
+		re, err := regexp.Compile(trimmed[1 : len(trimmed)-1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exclude-namespace regular expression %q", rawPattern)
+		}
+		return &namespacePattern{raw: rawPattern, regexp: re}, nil
+	}
+	if _, err := path.Match(trimmed, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid exclude-namespace glob %q", rawPattern)
+	}
+	return &namespacePattern{raw: rawPattern, glob: trimmed}, nil
+}
+
+func (p *namespacePattern) matches(namespace string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(namespace)
+	}
+	matched, _ := path.Match(p.glob, namespace)
+	return matched
+}
+
+// IsAllNamespaces reports whether the filter lets every namespace through
+func (f *NamespaceFilter) IsAllNamespaces() bool {
+	return f == nil || (f.Include == nil && 0 == len(f.Exclude))
+}
+
+// Matches reports whether a namespace is in scope
+func (f *NamespaceFilter) Matches(namespace string) bool {
+	if f == nil {
+		return true
+	}
+	if f.Include != nil {
+		if _, ok := f.Include[namespace]; !ok {
+			return false
+		}
+	}
+	for _, pattern := range f.Exclude {
+		if pattern.matches(namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// SingleNamespace returns the namespace when exactly one is included, so API calls can be scoped to it
+func (f *NamespaceFilter) SingleNamespace() string {
+	if f == nil || 1 != len(f.Include) {
+		return ""
+	}
+	for ns := range f.Include {
+		return ns
+	}
+	return ""
+}
+
+// RestrictToLabelSelector narrows the included namespaces to those matching the label selector
+func (f *NamespaceFilter) RestrictToLabelSelector(ctx context.Context, clientset kubernetes.Interface, selector string) error {
+	namespaces, err := ListNamespaces(ctx, clientset, selector)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list namespaces with selector '%s'", selector)
+	}
+	selected := make(map[string]struct{})
+	for _, ns := range namespaces.Items {
+		if f.Include != nil {
+			if _, ok := f.Include[ns.Name]; !ok {
+				continue
+			}
+		}
+		selected[ns.Name] = struct{}{}
+	}
+	f.Include = selected
+	return nil
+}
+
+// String describes the namespaces in scope, for logging
+func (f *NamespaceFilter) String() string {
+	var description string
+	if f == nil || f.Include == nil {
+		description = "all"
+	} else {
+		var names []string
+		for ns := range f.Include {
+			names = append(names, ns)
+		}
+		sort.Strings(names)
+		description = strings.Join(names, ",")
+	}
+	if f != nil && 0 < len(f.Exclude) {
+		var patterns []string
+		for _, pattern := range f.Exclude {
+			patterns = append(patterns, pattern.raw)
+		}
+		description = fmt.Sprintf("%s (excluding %s)", description, strings.Join(patterns, ","))
+	}
+	return description
+}
+
+func validateNamespaceSelector(selector string) error {
+	if selector == "" {
+		return nil
+	}
+	_, err := labels.Parse(selector)
+	return errors.Wrapf(err, "invalid namespace-selector %q", selector)
+}
+
+// ListNamespaces returns a list of namespaces matching the label selector
+func ListNamespaces(ctx context.Context, clientset kubernetes.Interface, selector string) (*corev1.NamespaceList, error) {
+	log.Tracef("getting a list of namespaces with selector: %s", selector)
+	return clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+}
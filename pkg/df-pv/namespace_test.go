@@ -0,0 +1,115 @@
+package df_pv
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNamespaceFilterMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces string
+		excludes   []string
+		matches    []string
+		rejects    []string
+	}{
+		{
+			name:    "empty filter matches everything",
+			matches: []string{"default", "kube-system"},
+		},
+		{
+			name:       "comma separated namespaces",
+			namespaces: "team-a, team-b",
+			matches:    []string{"team-a", "team-b"},
+			rejects:    []string{"team-c", "default"},
+		},
+		{
+			name:     "exact and glob exclusions",
+			excludes: []string{"kube-system", "ci-*"},
+			matches:  []string{"default", "monitoring", "cid"},
+			rejects:  []string{"kube-system", "ci-1234"},
+		},
+		{
+			name:     "regular expression exclusions",
+			excludes: []string{"/^(monitoring|logging)$/"},
+			matches:  []string{"monitoring-dev"},
+			rejects:  []string{"monitoring", "logging"},
+		},
+		{
+			name:       "exclusions apply to included namespaces",
+			namespaces: "team-a,ci-1",
+			excludes:   []string{"ci-*"},
+			matches:    []string{"team-a"},
+			rejects:    []string{"ci-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewNamespaceFilter(tt.namespaces, tt.excludes)
+			if err != nil {
+				t.Fatalf("NewNamespaceFilter returned unexpected error: %v", err)
+			}
+			for _, ns := range tt.matches {
+				if !filter.Matches(ns) {
+					t.Errorf("filter %s should match %q", filter, ns)
+				}
+			}
+			for _, ns := range tt.rejects {
+				if filter.Matches(ns) {
+					t.Errorf("filter %s should not match %q", filter, ns)
+				}
+			}
+		})
+	}
+}
+
+func TestNewNamespaceFilterRejectsInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"/[/", "ci-[", " "} {
+		if _, err := NewNamespaceFilter("", []string{pattern}); err == nil {
+			t.Errorf("NewNamespaceFilter accepted invalid pattern %q", pattern)
+		}
+	}
+}
+
+func TestFlagpoleNamespaceFilterRejectsInvalidSelector(t *testing.T) {
+	_, err := (&flagpole{namespaceSelector: "team in (a"}).namespaceFilter()
+	if err == nil || !strings.Contains(err.Error(), "invalid namespace-selector") {
+		t.Fatalf("namespaceFilter error = %v, want invalid namespace-selector message", err)
+	}
+}
+
+func TestGetWhichNodesToQueryBasedOnNamespaceOnlyUsesSelectedNamespaces(t *testing.T) {
+	cluster := &fakeCluster{pods: []corev1.Pod{
+		*newPodWithPVC("team-a", "pod-a", "node-a", "data-pod-a"),
+		*newPodWithPVC("team-b", "pod-b", "node-b", "data-pod-b"),
+		*newPodWithPVC("kube-system", "pod-c", "node-c", "data-pod-c"),
+	}}
+	clientset := newFakeClusterClientset(t, cluster)
+
+	filter, err := NewNamespaceFilter("", []string{"kube-*"})
+	if err != nil {
+		t.Fatalf("NewNamespaceFilter returned unexpected error: %v", err)
+	}
+	nodeNameToPodNames, err := GetWhichNodesToQueryBasedOnNamespace(context.Background(), clientset, filter)
+	if err != nil {
+		t.Fatalf("GetWhichNodesToQueryBasedOnNamespace returned unexpected error: %v", err)
+	}
+
+	var nodeNames []string
+	for nodeName := range nodeNameToPodNames {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	if want := []string{"node-a", "node-b"}; !reflect.DeepEqual(nodeNames, want) {
+		t.Fatalf("GetWhichNodesToQueryBasedOnNamespace nodes = %v, want %v", nodeNames, want)
+	}
+	if want := []string{"/api/v1/pods"}; !reflect.DeepEqual(cluster.requests(), want) {
+		t.Fatalf("requested paths = %v, want %v", cluster.requests(), want)
+	}
+}
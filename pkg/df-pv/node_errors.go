@@ -0,0 +1,149 @@
+package df_pv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Error classes reported for nodes that could not be queried
+const (
+	nodeErrorClassTimeout         = "timeout"
+	nodeErrorClassForbidden       = "forbidden"
+	nodeErrorClassUnauthorized    = "unauthorized"
+	nodeErrorClassNotFound        = "not-found"
+	nodeErrorClassThrottled       = "throttled"
+	nodeErrorClassServerError     = "5xx"
+	nodeErrorClassInvalidResponse = "invalid-response"
+	nodeErrorClassOther           = "other"
+)
+
+// Exit codes returned by the root command
+const (
+	exitCodeError          = 1
+	exitCodePartialResults = 2
+)
+
+// NodeError records why volume stats could not be collected from a node
+type NodeError struct {
+	NodeName string `json:"nodeName"`
+	Class    string `json:"class"`
+	Message  string `json:"message"`
+}
+
+// NodeCollectionError is returned when one or more nodes could not be queried
+type NodeCollectionError struct {
+	FailedNodes []*NodeError
+	TotalNodes  int
+}
+
+func (e *NodeCollectionError) Error() string {
+	return fmt.Sprintf("failed to collect volume stats from %d of %d nodes", len(e.FailedNodes), e.TotalNodes)
+}
+
+// IsPartial reports whether at least one node was queried successfully
+func (e *NodeCollectionError) IsPartial() bool {
+	return len(e.FailedNodes) < e.TotalNodes
+}
+
+// nodeErrorRecorder collects per-node errors from concurrent producers
+type nodeErrorRecorder struct {
+	mu          sync.Mutex
+	failedNodes []*NodeError
+}
+
+func (r *nodeErrorRecorder) record(nodeName string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failedNodes = append(r.failedNodes, &NodeError{
+		NodeName: nodeName,
+		Class:    classifyNodeError(err),
+		Message:  err.Error(),
+	})
+}
+
+// result returns a *NodeCollectionError when any node failed, nil otherwise
+func (r *nodeErrorRecorder) result(totalNodes int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if 0 == len(r.failedNodes) {
+		return nil
+	}
+	failedNodes := append([]*NodeError(nil), r.failedNodes...)
+	sort.Slice(failedNodes, func(i, j int) bool { return failedNodes[i].NodeName < failedNodes[j].NodeName })
+	return &NodeCollectionError{FailedNodes: failedNodes, TotalNodes: totalNodes}
+}
+
+// classifyNodeError maps an error from a node request into a coarse class for reporting
+func classifyNodeError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err):
+		return nodeErrorClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return nodeErrorClassTimeout
+	case apierrors.IsForbidden(err):
+		return nodeErrorClassForbidden
+	case apierrors.IsUnauthorized(err):
+		return nodeErrorClassUnauthorized
+	case apierrors.IsNotFound(err):
+		return nodeErrorClassNotFound
+	case apierrors.IsTooManyRequests(err):
+		return nodeErrorClassThrottled
+	}
+	var statusErr apierrors.APIStatus
+	if errors.As(err, &statusErr) && statusErr.Status().Code >= 500 {
+		return nodeErrorClassServerError
+	}
+	if apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err) {
+		return nodeErrorClassServerError
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return nodeErrorClassInvalidResponse
+	}
+	return nodeErrorClassOther
+}
+
+// PrintNodeErrors writes a summary of the nodes that could not be queried
+func PrintNodeErrors(w io.Writer, collectionErr *NodeCollectionError) error {
+	if collectionErr.IsPartial() {
+		fmt.Fprintf(w, "WARNING: %s; results are partial\n", collectionErr.Error())
+	} else {
+		fmt.Fprintf(w, "ERROR: %s\n", collectionErr.Error())
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tCLASS\tERROR")
+	for _, nodeErr := range collectionErr.FailedNodes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", nodeErr.NodeName, nodeErr.Class, nodeErr.Message)
+	}
+	return tw.Flush()
+}
+
+// ExitCodeError carries the process exit code of a command that already reported its failure itself, e.g. by
+// listing the failed nodes, so that it is not reported again; Err may be nil
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,114 @@
+package df_pv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestProduceOutputRowsConcurrentlyContinuesPastFailedNodes(t *testing.T) {
+	summary := `{"pods":[{"podRef":{"name":"pod-b","namespace":"ns-b"},"volume":[{"name":"data","capacityBytes":100,"usedBytes":10,"availableBytes":90,"inodes":10,"inodesUsed":1,"inodesFree":9,"pvcRef":{"name":"pvc-b","namespace":"ns-b"}}]}]}`
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		nodeSummaries:  map[string]string{"node-b": summary},
+		nodeStatusCode: map[string]int{"node-a": http.StatusForbidden},
+		pvcs:           []corev1.PersistentVolumeClaim{newBoundPVC("ns-b", "pvc-b", "pv-b")},
+	})
+
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	result := make(chan error, 1)
+	go func() {
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{"node-a", "node-b"}, NodeQueryOptions{}, outputRowPVCChan)
+	}()
+	rows := ConsumeOutputRowsConcurrently(outputRowPVCChan)
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(time.Second):
+		t.Fatal("ProduceOutputRowsConcurrently did not return")
+	}
+	if len(rows) != 1 || rows[0].PVCName != "pvc-b" || rows[0].PVName != "pv-b" || rows[0].NodeName != "node-b" {
+		t.Fatalf("expected the row from node-b despite node-a failing, got %+v", rows)
+	}
+	var collectionErr *NodeCollectionError
+	if !errors.As(err, &collectionErr) {
+		t.Fatalf("ProduceOutputRowsConcurrently error = %v, want *NodeCollectionError", err)
+	}
+	if !collectionErr.IsPartial() || collectionErr.TotalNodes != 2 || len(collectionErr.FailedNodes) != 1 {
+		t.Fatalf("unexpected collection error: %+v", collectionErr)
+	}
+	if failed := collectionErr.FailedNodes[0]; failed.NodeName != "node-a" || failed.Class != nodeErrorClassForbidden {
+		t.Fatalf("unexpected failed node: %+v", failed)
+	}
+
+	var buf bytes.Buffer
+	if err := PrintNodeErrors(&buf, collectionErr); err != nil {
+		t.Fatalf("PrintNodeErrors returned unexpected error: %v", err)
+	}
+	for _, want := range []string{"WARNING: failed to collect volume stats from 1 of 2 nodes; results are partial", "node-a", "forbidden"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("PrintNodeErrors output = %q, missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestProduceOutputRowsConcurrentlySkipsUnresolvedClaims(t *testing.T) {
+	// pvc-deleted was deleted; pvc-pending is not bound yet
+	summary := `{"pods":[{"podRef":{"name":"pod-b","namespace":"ns-b"},"volume":[` +
+		`{"name":"data","capacityBytes":100,"usedBytes":10,"availableBytes":90,"pvcRef":{"name":"pvc-b","namespace":"ns-b"}},` +
+		`{"name":"old","capacityBytes":100,"usedBytes":50,"availableBytes":50,"pvcRef":{"name":"pvc-deleted","namespace":"ns-b"}},` +
+		`{"name":"new","capacityBytes":100,"usedBytes":0,"availableBytes":100,"pvcRef":{"name":"pvc-pending","namespace":"ns-b"}}]}]}`
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		nodeSummaries: map[string]string{"node-b": summary},
+		pvcs:          []corev1.PersistentVolumeClaim{newBoundPVC("ns-b", "pvc-b", "pv-b"), newBoundPVC("ns-b", "pvc-pending", "")},
+	})
+
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	result := make(chan error, 1)
+	go func() {
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{"node-b"}, NodeQueryOptions{}, outputRowPVCChan)
+	}()
+	rows := ConsumeOutputRowsConcurrently(outputRowPVCChan)
+	if err := <-result; err != nil {
+		t.Fatalf("ProduceOutputRowsConcurrently returned unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].PVCName != "pvc-b" || rows[0].PVName != "pv-b" {
+		t.Fatalf("expected only the row of pvc-b, got %+v", rows)
+	}
+}
+
+func TestClassifyNodeError(t *testing.T) {
+	resource := schema.GroupResource{Resource: "nodes"}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "deadline", err: errors.Wrap(context.DeadlineExceeded, "get stats"), want: nodeErrorClassTimeout},
+		{name: "server timeout", err: apierrors.NewServerTimeout(resource, "get", 1), want: nodeErrorClassTimeout},
+		{name: "forbidden", err: apierrors.NewForbidden(resource, "node-a", errors.New("nope")), want: nodeErrorClassForbidden},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("nope"), want: nodeErrorClassUnauthorized},
+		{name: "not found", err: apierrors.NewNotFound(resource, "node-a"), want: nodeErrorClassNotFound},
+		{name: "throttled", err: apierrors.NewTooManyRequests("slow down", 1), want: nodeErrorClassThrottled},
+		{name: "5xx", err: errors.Wrap(apierrors.NewGenericServerResponse(http.StatusBadGateway, "get", resource, "node-a", "", 0, false), "get stats"), want: nodeErrorClassServerError},
+		{name: "invalid json", err: errors.Wrap(json.Unmarshal([]byte("{"), &struct{}{}), "unmarshal"), want: nodeErrorClassInvalidResponse},
+		{name: "other", err: errors.New("boom"), want: nodeErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyNodeError(tt.err); got != tt.want {
+				t.Fatalf("classifyNodeError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// maxRetryBackoff caps the exponential backoff between retries of a node request
+const maxRetryBackoff = 10 * time.Second
+
+// NodeQueryOptions controls how nodes are queried for volume stats; the zero value queries every node at once,
+// without a per-node timeout and without retries
+type NodeQueryOptions struct {
+	// MaxConcurrency is the number of nodes queried at the same time; 0 means unlimited
+	MaxConcurrency int
+	// Timeout applies to each stats request sent to a node; 0 means no timeout
+	Timeout time.Duration
+	// Retries is how many times a request failing with a transient error (5xx or 429) is retried
+	Retries int
+	// InitialBackoff is the wait before the first retry, doubled for every subsequent one
+	InitialBackoff time.Duration
+	// Kubelet chooses whether the kubelets are queried directly instead of through the API server proxy
+	Kubelet KubeletOptions
+
+	// kubeletClient queries the kubelets directly once connected by withKubeletClient
+	kubeletClient *KubeletClient
+}
+
+func (opts NodeQueryOptions) validate() error {
+	if opts.MaxConcurrency < 0 {
+		return fmt.Errorf("max-concurrency cannot be negative, got %d", opts.MaxConcurrency)
+	}
+	if opts.Timeout < 0 {
+		return fmt.Errorf("node-timeout cannot be negative, got %s", opts.Timeout)
+	}
+	if opts.Retries < 0 {
+		return fmt.Errorf("node-retries cannot be negative, got %d", opts.Retries)
+	}
+	return opts.Kubelet.validate()
+}
+
+// workers returns how many workers should query the given number of nodes
+func (opts NodeQueryOptions) workers(totalNodes int) int {
+	if opts.MaxConcurrency <= 0 || opts.MaxConcurrency > totalNodes {
+		return totalNodes
+	}
+	return opts.MaxConcurrency
+}
+
+// GetRequestTimeoutFromGenericCliConfigFlags returns the --request-timeout value; 0 means no timeout
+func GetRequestTimeoutFromGenericCliConfigFlags(genericCliConfigFlags *genericclioptions.ConfigFlags) (time.Duration, error) {
+	if genericCliConfigFlags == nil || genericCliConfigFlags.Timeout == nil {
+		return 0, nil
+	}
+	timeout, err := clientcmd.ParseTimeout(*genericCliConfigFlags.Timeout)
+	return timeout, errors.Wrapf(err, "invalid request-timeout %q", *genericCliConfigFlags.Timeout)
+}
+
+// isRetryableNodeError reports whether a failed node request is worth retrying
+func isRetryableNodeError(err error) bool {
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	var statusErr apierrors.APIStatus
+	return errors.As(err, &statusErr) && statusErr.Status().Code >= 500
+}
+
+// Endpoints of the kubelet that report volume stats
+const (
+	kubeletStatsSummaryPath = "stats/summary"
+	kubeletMetricsPath      = "metrics"
+)
+
+// GetStatsSummaryFromNode fetches the raw stats/summary of a node through the kube-apiserver node proxy, or from its
+// kubelet directly, retrying transient failures with exponential backoff
+func GetStatsSummaryFromNode(ctx context.Context, clientset kubernetes.Interface, nodeName string, queryOptions NodeQueryOptions) ([]byte, error) {
+	return getFromNode(ctx, clientset, nodeName, kubeletStatsSummaryPath, queryOptions)
+}
+
+// GetMetricsFromNode fetches the raw Prometheus metrics of the kubelet of a node like GetStatsSummaryFromNode
+func GetMetricsFromNode(ctx context.Context, clientset kubernetes.Interface, nodeName string, queryOptions NodeQueryOptions) ([]byte, error) {
+	return getFromNode(ctx, clientset, nodeName, kubeletMetricsPath, queryOptions)
+}
+
+// isSummaryUnavailableError reports whether a node refuses or does not serve stats/summary, in which case its
+// metrics may still be readable
+func isSummaryUnavailableError(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsNotFound(err)
+}
+
+func getFromNode(ctx context.Context, clientset kubernetes.Interface, nodeName string, path string, queryOptions NodeQueryOptions) ([]byte, error) {
+	backoff := queryOptions.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		responseRawArrayOfBytes, err := getFromNodeOnce(ctx, clientset, nodeName, path, queryOptions)
+		if err == nil {
+			return responseRawArrayOfBytes, nil
+		}
+		if attempt >= queryOptions.Retries || !isRetryableNodeError(err) {
+			return nil, err
+		}
+
+		wait := backoff
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		if wait > maxRetryBackoff {
+			wait = maxRetryBackoff
+		}
+		log.Debugf("retrying %s request to node '%s' in %s (attempt %d of %d): %v", path, nodeName, wait, attempt+1, queryOptions.Retries, err)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "gave up retrying after: %v", err)
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func getFromNodeOnce(ctx context.Context, clientset kubernetes.Interface, nodeName string, path string, queryOptions NodeQueryOptions) ([]byte, error) {
+	if queryOptions.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryOptions.Timeout)
+		defer cancel()
+	}
+	if queryOptions.kubeletClient != nil {
+		return queryOptions.kubeletClient.Get(ctx, nodeName, path)
+	}
+	request := clientset.CoreV1().RESTClient().Get().Resource("nodes").Name(nodeName).SubResource("proxy").Suffix(path)
+	return request.Do(ctx).Raw()
+}
@@ -0,0 +1,128 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestGetStatsSummaryFromNodeRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		retries      int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "retries 503 then succeeds", statusCodes: []int{http.StatusServiceUnavailable, http.StatusBadGateway}, retries: 2, wantRequests: 3},
+		{name: "retries 429", statusCodes: []int{http.StatusTooManyRequests}, retries: 1, wantRequests: 2},
+		{name: "gives up after retries", statusCodes: []int{http.StatusInternalServerError, http.StatusInternalServerError}, retries: 1, wantErr: true, wantRequests: 2},
+		{name: "does not retry forbidden", statusCodes: []int{http.StatusForbidden}, retries: 3, wantErr: true, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestCount int32
+			clientset := newHandlerClientset(t, func(w http.ResponseWriter, _ *http.Request) {
+				n := atomic.AddInt32(&requestCount, 1)
+				if int(n) <= len(tt.statusCodes) {
+					http.Error(w, "test node error", tt.statusCodes[n-1])
+					return
+				}
+				fmt.Fprint(w, `{"pods":[]}`)
+			})
+
+			_, err := GetStatsSummaryFromNode(context.Background(), clientset, "node-a", NodeQueryOptions{Retries: tt.retries, InitialBackoff: time.Millisecond})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetStatsSummaryFromNode error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&requestCount); got != tt.wantRequests {
+				t.Fatalf("expected %d requests, got %d", tt.wantRequests, got)
+			}
+		})
+	}
+}
+
+func TestGetStatsSummaryFromNodeAppliesNodeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	clientset := newHandlerClientset(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+
+	start := time.Now()
+	_, err := GetStatsSummaryFromNode(context.Background(), clientset, "node-a", NodeQueryOptions{Timeout: 50 * time.Millisecond})
+	if err == nil {
+		t.Fatal("GetStatsSummaryFromNode returned nil for a hung node")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("GetStatsSummaryFromNode took %s despite a 50ms node timeout", elapsed)
+	}
+	if got := classifyNodeError(err); got != nodeErrorClassTimeout {
+		t.Fatalf("classifyNodeError(%v) = %q, want %q", err, got, nodeErrorClassTimeout)
+	}
+}
+
+func TestProduceOutputRowsConcurrentlyBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	clientset := newHandlerClientset(t, func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `{"pods":[]}`)
+	})
+
+	var nodeNames []string
+	for i := 0; i < 10; i++ {
+		nodeNames = append(nodeNames, fmt.Sprintf("node-%d", i))
+	}
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	result := make(chan error, 1)
+	go func() {
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, nodeNames, NodeQueryOptions{MaxConcurrency: 3}, outputRowPVCChan)
+	}()
+	ConsumeOutputRowsConcurrently(outputRowPVCChan)
+	if err := <-result; err != nil {
+		t.Fatalf("ProduceOutputRowsConcurrently returned unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight > 3 || maxInFlight == 0 {
+		t.Fatalf("expected between 1 and 3 concurrent node requests, got %d", maxInFlight)
+	}
+}
+
+func TestGetRequestTimeoutFromGenericCliConfigFlags(t *testing.T) {
+	configFlags := genericclioptions.NewConfigFlags(false)
+	for value, want := range map[string]time.Duration{"0": 0, "5": 5 * time.Second, "2m": 2 * time.Minute} {
+		*configFlags.Timeout = value
+		got, err := GetRequestTimeoutFromGenericCliConfigFlags(configFlags)
+		if err != nil || got != want {
+			t.Fatalf("GetRequestTimeoutFromGenericCliConfigFlags(%q) = %s, %v; want %s", value, got, err, want)
+		}
+	}
+
+	*configFlags.Timeout = "soon"
+	if _, err := GetRequestTimeoutFromGenericCliConfigFlags(configFlags); err == nil || !strings.Contains(err.Error(), "invalid request-timeout") {
+		t.Fatalf("GetRequestTimeoutFromGenericCliConfigFlags error = %v, want invalid request-timeout", err)
+	}
+}
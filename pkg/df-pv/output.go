@@ -0,0 +1,227 @@
+package df_pv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputFormatTable = "table"
+	outputFormatJSON  = "json"
+	outputFormatYAML  = "yaml"
+	outputFormatCSV   = "csv"
+	outputFormatTSV   = "tsv"
+)
+
+var availableOutputFormats = []string{outputFormatTable, outputFormatJSON, outputFormatYAML, outputFormatCSV, outputFormatTSV}
+
+// VolumeUsageListAPIVersion is the apiVersion of the structured output envelope
+const VolumeUsageListAPIVersion = "df-pv.io/v1alpha1"
+
+// VolumeUsageListKind is the kind of the structured output envelope
+const VolumeUsageListKind = "VolumeUsageList"
+
+// VolumeUsageList is the versioned envelope used for structured (json/yaml) output
+type VolumeUsageList struct {
+	APIVersion string                  `json:"apiVersion"`
+	Kind       string                  `json:"kind"`
+	Metadata   VolumeUsageListMetadata `json:"metadata"`
+	Items      []*OutputRowPVC         `json:"items"`
+	// GroupBy, Groups and Total are only set with --group-by or --summary
+	GroupBy string              `json:"groupBy,omitempty"`
+	Groups  []*VolumeUsageGroup `json:"groups,omitempty"`
+	Total   *VolumeUsageTotal   `json:"total,omitempty"`
+}
+
+// VolumeUsageGroup holds the volumes sharing the same --group-by key; Items is empty with --summary
+type VolumeUsageGroup struct {
+	Key      string            `json:"key"`
+	Subtotal *VolumeUsageTotal `json:"subtotal"`
+	Items    []*OutputRowPVC   `json:"items,omitempty"`
+}
+
+// VolumeUsageTotal is the combined usage of a set of volumes; percentages are omitted when they cannot be computed
+type VolumeUsageTotal struct {
+	Volumes             int                `json:"volumes"`
+	AvailableBytes      *resource.Quantity `json:"availableBytes"`
+	CapacityBytes       *resource.Quantity `json:"capacityBytes"`
+	UsedBytes           *resource.Quantity `json:"usedBytes"`
+	AvailableBytesValue int64              `json:"availableBytesValue"`
+	CapacityBytesValue  int64              `json:"capacityBytesValue"`
+	UsedBytesValue      int64              `json:"usedBytesValue"`
+	InodesFree          uint64             `json:"inodesFree"`
+	Inodes              uint64             `json:"inodes"`
+	InodesUsed          uint64             `json:"inodesUsed"`
+	PercentageUsed      *float64           `json:"percentageUsed,omitempty"`
+	PercentageIUsed     *float64           `json:"percentageIUsed,omitempty"`
+}
+
+// NewVolumeUsageTotal converts the sum of a set of rows, as computed by SumOutputRows, for structured output
+func NewVolumeUsageTotal(sum *OutputRowPVC, volumes int) *VolumeUsageTotal {
+	return &VolumeUsageTotal{
+		Volumes:             volumes,
+		AvailableBytes:      sum.AvailableBytes,
+		CapacityBytes:       sum.CapacityBytes,
+		UsedBytes:           sum.UsedBytes,
+		AvailableBytesValue: quantityValue(sum.AvailableBytes),
+		CapacityBytesValue:  quantityValue(sum.CapacityBytes),
+		UsedBytesValue:      quantityValue(sum.UsedBytes),
+		InodesFree:          sum.InodesFree,
+		Inodes:              sum.Inodes,
+		InodesUsed:          sum.InodesUsed,
+		PercentageUsed:      finitePercentage(sum.PercentageUsed),
+		PercentageIUsed:     finitePercentage(sum.PercentageIUsed),
+	}
+}
+
+func finitePercentage(percentage float64) *float64 {
+	if math.IsNaN(percentage) || math.IsInf(percentage, 0) {
+		return nil
+	}
+	return &percentage
+}
+
+// SetGroups adds the groups and the grand total to the list; with summary only the totals are kept
+func (list *VolumeUsageList) SetGroups(groups []*OutputRowGroup, groupBy string, summary bool) {
+	list.Total = NewVolumeUsageTotal(SumOutputRows(list.Items), len(uniqueVolumes(list.Items)))
+	list.GroupBy = groupBy
+	for _, group := range groups {
+		usageGroup := &VolumeUsageGroup{Key: group.Key, Subtotal: NewVolumeUsageTotal(group.Subtotal, group.Volumes)}
+		if !summary {
+			usageGroup.Items = group.Rows
+		}
+		list.Groups = append(list.Groups, usageGroup)
+	}
+	if summary {
+		list.Items = []*OutputRowPVC{}
+	}
+}
+
+// VolumeUsageListMetadata describes when and where the volume usage was collected
+type VolumeUsageListMetadata struct {
+	CollectionTimestamp metav1.Time  `json:"collectionTimestamp"`
+	Context             string       `json:"context,omitempty"`
+	FailedNodes         []*NodeError `json:"failedNodes,omitempty"`
+}
+
+// NewVolumeUsageList wraps the output rows in a versioned envelope
+func NewVolumeUsageList(sliceOfOutputRowPVC []*OutputRowPVC, contextName string, collectedAt time.Time) *VolumeUsageList {
+	items := sliceOfOutputRowPVC
+	if items == nil {
+		items = []*OutputRowPVC{}
+	}
+	return &VolumeUsageList{
+		APIVersion: VolumeUsageListAPIVersion,
+		Kind:       VolumeUsageListKind,
+		Metadata: VolumeUsageListMetadata{
+			CollectionTimestamp: metav1.NewTime(collectedAt.UTC()),
+			Context:             contextName,
+		},
+		Items: items,
+	}
+}
+
+func parseOutputFormat(output string) (string, error) {
+	normalizedFormat := strings.TrimSpace(strings.ToLower(output))
+	if normalizedFormat == "" {
+		return outputFormatTable, nil
+	}
+	for _, format := range availableOutputFormats {
+		if normalizedFormat == format {
+			return normalizedFormat, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q; available formats: %s", output, strings.Join(availableOutputFormats, ", "))
+}
+
+func isStructuredOutputFormat(format string) bool {
+	return format == outputFormatJSON || format == outputFormatYAML
+}
+
+func isDelimitedOutputFormat(format string) bool {
+	return format == outputFormatCSV || format == outputFormatTSV
+}
+
+func delimiterForOutputFormat(format string) rune {
+	if format == outputFormatTSV {
+		return '\t'
+	}
+	return ','
+}
+
+// PrintStructured writes the volume usage list as json or yaml
+func PrintStructured(w io.Writer, list *VolumeUsageList, format string) error {
+	var out []byte
+	var err error
+	switch format {
+	case outputFormatJSON:
+		out, err = json.MarshalIndent(list, "", "  ")
+		out = append(out, '\n')
+	case outputFormatYAML:
+		out, err = yaml.Marshal(list)
+	default:
+		return fmt.Errorf("unsupported structured output format %q", format)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal output as %s", format)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// MarshalJSON emits the byte fields both as resource.Quantity strings and as plain integers; percentages that
+// cannot be computed (e.g. for volumes not reporting inodes) are emitted as null
+func (row *OutputRowPVC) MarshalJSON() ([]byte, error) {
+	type outputRowPVCAlias OutputRowPVC
+	return json.Marshal(&struct {
+		*outputRowPVCAlias
+		AvailableBytesValue int64    `json:"availableBytesValue"`
+		CapacityBytesValue  int64    `json:"capacityBytesValue"`
+		UsedBytesValue      int64    `json:"usedBytesValue"`
+		RequestedBytesValue *int64   `json:"requestedBytesValue,omitempty"`
+		PercentageUsed      *float64 `json:"percentageUsed"`
+		PercentageIUsed     *float64 `json:"percentageIUsed"`
+	}{
+		outputRowPVCAlias:   (*outputRowPVCAlias)(row),
+		AvailableBytesValue: quantityValue(row.AvailableBytes),
+		CapacityBytesValue:  quantityValue(row.CapacityBytes),
+		UsedBytesValue:      quantityValue(row.UsedBytes),
+		RequestedBytesValue: optionalQuantityValue(row.RequestedBytes),
+		PercentageUsed:      finitePercentage(row.PercentageUsed),
+		PercentageIUsed:     finitePercentage(row.PercentageIUsed),
+	})
+}
+
+// GetContextNameFromGenericCliConfigFlags returns the kubeconfig context the request is made against
+func GetContextNameFromGenericCliConfigFlags(genericCliConfigFlags *genericclioptions.ConfigFlags) string {
+	if genericCliConfigFlags == nil {
+		return ""
+	}
+	if genericCliConfigFlags.Context != nil && 0 < len(*genericCliConfigFlags.Context) {
+		return *genericCliConfigFlags.Context
+	}
+	rawConfig, err := genericCliConfigFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return rawConfig.CurrentContext
+}
+
+// optionalQuantityValue returns the value of a quantity, or nil when the quantity is unknown
+func optionalQuantityValue(quantity *resource.Quantity) *int64 {
+	if quantity == nil {
+		return nil
+	}
+	value := quantity.Value()
+	return &value
+}
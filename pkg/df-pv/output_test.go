@@ -0,0 +1,124 @@
+package df_pv
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		output     string
+		want       string
+		errorMatch string
+	}{
+		{output: "", want: outputFormatTable},
+		{output: "table", want: outputFormatTable},
+		{output: " JSON ", want: outputFormatJSON},
+		{output: "yaml", want: outputFormatYAML},
+		{output: "xml", errorMatch: `unknown output format "xml"`},
+	}
+
+	for _, tt := range tests {
+		got, err := parseOutputFormat(tt.output)
+		if tt.errorMatch != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errorMatch) {
+				t.Fatalf("parseOutputFormat(%q) error = %v, want substring %q", tt.output, err, tt.errorMatch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseOutputFormat(%q) returned unexpected error: %v", tt.output, err)
+		}
+		if got != tt.want {
+			t.Fatalf("parseOutputFormat(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestPrintStructuredJSONIncludesEnvelopeAndRawBytes(t *testing.T) {
+	rows := []*OutputRowPVC{{
+		PVName:         "pv-a",
+		PVCName:        "pvc-a",
+		Namespace:      "ns-a",
+		CapacityBytes:  resource.NewQuantity(10<<30, resource.BinarySI),
+		UsedBytes:      resource.NewQuantity(2<<30, resource.BinarySI),
+		AvailableBytes: resource.NewQuantity(8<<30, resource.BinarySI),
+		PercentageUsed: 20,
+	}}
+	collectedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := PrintStructured(&buf, NewVolumeUsageList(rows, "ctx-a", collectedAt), outputFormatJSON); err != nil {
+		t.Fatalf("PrintStructured returned unexpected error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("PrintStructured output is not valid json: %v\n%s", err, buf.String())
+	}
+	if got["apiVersion"] != VolumeUsageListAPIVersion || got["kind"] != VolumeUsageListKind {
+		t.Fatalf("unexpected envelope: %v", got)
+	}
+	metadata := got["metadata"].(map[string]interface{})
+	if metadata["context"] != "ctx-a" || metadata["collectionTimestamp"] != "2020-01-02T03:04:05Z" {
+		t.Fatalf("unexpected metadata: %v", metadata)
+	}
+	item := got["items"].([]interface{})[0].(map[string]interface{})
+	if item["capacityBytes"] != "10Gi" {
+		t.Fatalf("capacityBytes = %v, want quantity string 10Gi", item["capacityBytes"])
+	}
+	if item["capacityBytesValue"] != float64(10<<30) || item["usedBytesValue"] != float64(2<<30) || item["availableBytesValue"] != float64(8<<30) {
+		t.Fatalf("unexpected raw byte values in item: %v", item)
+	}
+}
+
+func TestPrintStructuredJSONEmitsNullForZeroCapacityPercentages(t *testing.T) {
+	rows := []*OutputRowPVC{withPercentageIUsed(newTestRow("ns-a", "pvc-a", 0, 0), math.Inf(1))}
+
+	var buf bytes.Buffer
+	if err := PrintStructured(&buf, NewVolumeUsageList(rows, "", time.Now()), outputFormatJSON); err != nil {
+		t.Fatalf("PrintStructured returned unexpected error for a zero-capacity volume: %v", err)
+	}
+
+	var raw struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("PrintStructured output is not valid json: %v\n%s", err, buf.String())
+	}
+	item := raw.Items[0]
+	for _, field := range []string{"percentageUsed", "percentageIUsed"} {
+		value, ok := item[field]
+		if !ok || value != nil {
+			t.Fatalf("%s = %v (present: %v), want null", field, value, ok)
+		}
+	}
+}
+
+func TestPrintStructuredYAMLEmitsEmptyItems(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PrintStructured(&buf, NewVolumeUsageList(nil, "", time.Now()), outputFormatYAML); err != nil {
+		t.Fatalf("PrintStructured returned unexpected error: %v", err)
+	}
+	for _, want := range []string{"apiVersion: " + VolumeUsageListAPIVersion, "kind: " + VolumeUsageListKind, "items: []"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("PrintStructured output = %q, missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestRunRootCommandRejectsInvalidOutputFormatBeforeKubernetesAccess(t *testing.T) {
+	err := runRootCommand(&flagpole{output: "xml"})
+	if err == nil {
+		t.Fatal("runRootCommand returned nil for an invalid output format")
+	}
+	if !strings.Contains(err.Error(), `unknown output format "xml"`) {
+		t.Fatalf("runRootCommand error = %q, want unknown-output-format message", err)
+	}
+}
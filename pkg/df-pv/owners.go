@@ -0,0 +1,112 @@
+package df_pv
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WorkloadOwnerIndex resolves the workload owning a pod (Pod -> ReplicaSet -> Deployment, Pod -> StatefulSet,
+// Pod -> Job -> CronJob, ...); it is loaded lazily with one list call per kind
+type WorkloadOwnerIndex struct {
+	clientset kubernetes.Interface
+	namespace string
+
+	once        sync.Once
+	loadErr     error
+	pods        map[string]*corev1.Pod
+	replicaSets map[string]*metav1.OwnerReference
+	jobs        map[string]*metav1.OwnerReference
+}
+
+// NewWorkloadOwnerIndex creates an index of the pods, ReplicaSets and Jobs in namespace (all namespaces if empty)
+func NewWorkloadOwnerIndex(clientset kubernetes.Interface, namespace string) *WorkloadOwnerIndex {
+	return &WorkloadOwnerIndex{
+		clientset: clientset,
+		namespace: namespace,
+	}
+}
+
+func (idx *WorkloadOwnerIndex) load(ctx context.Context) error {
+	idx.once.Do(func() {
+		podList, err := ListPods(ctx, idx.clientset, idx.namespace)
+		if err != nil {
+			idx.loadErr = errors.Wrapf(err, "failed to list pods")
+			return
+		}
+		idx.pods = make(map[string]*corev1.Pod, len(podList.Items))
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			idx.pods[namespacedKey(pod.Namespace, pod.Name)] = pod
+		}
+
+		// ReplicaSets and Jobs are only needed to go one level further up, so they are optional
+		replicaSetList, err := idx.clientset.AppsV1().ReplicaSets(idx.namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Warnf("unable to list ReplicaSets, their Deployments will not be resolved: %v", err)
+		} else {
+			idx.replicaSets = make(map[string]*metav1.OwnerReference, len(replicaSetList.Items))
+			for i := range replicaSetList.Items {
+				replicaSet := &replicaSetList.Items[i]
+				idx.replicaSets[namespacedKey(replicaSet.Namespace, replicaSet.Name)] = metav1.GetControllerOf(replicaSet)
+			}
+		}
+		jobList, err := idx.clientset.BatchV1().Jobs(idx.namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Warnf("unable to list Jobs, their CronJobs will not be resolved: %v", err)
+		} else {
+			idx.jobs = make(map[string]*metav1.OwnerReference, len(jobList.Items))
+			for i := range jobList.Items {
+				job := &jobList.Items[i]
+				idx.jobs[namespacedKey(job.Namespace, job.Name)] = metav1.GetControllerOf(job)
+			}
+		}
+	})
+	return idx.loadErr
+}
+
+// GetOwner returns the kind and name of the top-level workload owning the pod; a pod without a controller owns
+// itself, and an unknown pod has no owner
+func (idx *WorkloadOwnerIndex) GetOwner(ctx context.Context, namespace string, podName string) (string, string, error) {
+	if err := idx.load(ctx); err != nil {
+		return "", "", err
+	}
+	pod, ok := idx.pods[namespacedKey(namespace, podName)]
+	if !ok {
+		return "", "", nil
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod", pod.Name, nil
+	}
+
+	// Deployments and CronJobs own their pods through a ReplicaSet and a Job respectively
+	var parents map[string]*metav1.OwnerReference
+	switch owner.Kind {
+	case "ReplicaSet":
+		parents = idx.replicaSets
+	case "Job":
+		parents = idx.jobs
+	}
+	if parent := parents[namespacedKey(namespace, owner.Name)]; parent != nil {
+		return parent.Kind, parent.Name, nil
+	}
+	return owner.Kind, owner.Name, nil
+}
+
+// ResolveOwners sets the owner of every row; when pods cannot be listed the owners are left empty
+func (idx *WorkloadOwnerIndex) ResolveOwners(ctx context.Context, sliceOfOutputRowPVC []*OutputRowPVC) {
+	for _, row := range sliceOfOutputRowPVC {
+		ownerKind, ownerName, err := idx.GetOwner(ctx, row.Namespace, row.PodName)
+		if err != nil {
+			log.Warnf("unable to resolve the workloads owning the volumes: %v", err)
+			return
+		}
+		row.OwnerKind, row.OwnerName = ownerKind, ownerName
+	}
+}
@@ -0,0 +1,60 @@
+package df_pv
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func controlledBy(kind string, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestWorkloadOwnerIndexResolvesOwnerChain(t *testing.T) {
+	cluster := &fakeCluster{
+		pods: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-7d9-abc", OwnerReferences: controlledBy("ReplicaSet", "web-7d9")}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-0", OwnerReferences: controlledBy("StatefulSet", "db")}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "backup-123-xyz", OwnerReferences: controlledBy("Job", "backup-123")}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "bare"}},
+		},
+		replicaSets: []appsv1.ReplicaSet{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-7d9", OwnerReferences: controlledBy("Deployment", "web")}},
+		},
+		jobs: []batchv1.Job{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "backup-123", OwnerReferences: controlledBy("CronJob", "backup")}},
+		},
+	}
+	clientset := newFakeClusterClientset(t, cluster)
+
+	rows := []*OutputRowPVC{
+		{Namespace: "ns", PodName: "web-7d9-abc"},
+		{Namespace: "ns", PodName: "db-0"},
+		{Namespace: "ns", PodName: "backup-123-xyz"},
+		{Namespace: "ns", PodName: "bare"},
+		{Namespace: "ns", PodName: "gone"},
+	}
+	NewWorkloadOwnerIndex(clientset, "").ResolveOwners(context.Background(), rows)
+
+	want := []string{"Deployment/web", "StatefulSet/db", "CronJob/backup", "Pod/bare", "/"}
+	for i, row := range rows {
+		if got := row.OwnerKind + "/" + row.OwnerName; got != want[i] {
+			t.Fatalf("owner of %s = %q, want %q", row.PodName, got, want[i])
+		}
+	}
+
+	listCalls := 0
+	for _, path := range cluster.requests() {
+		if path == "/api/v1/pods" || path == "/apis/apps/v1/replicasets" || path == "/apis/batch/v1/jobs" {
+			listCalls++
+		}
+	}
+	if listCalls != 3 {
+		t.Fatalf("expected one list call per kind, got requests %v", cluster.requests())
+	}
+}
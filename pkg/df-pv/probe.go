@@ -0,0 +1,512 @@
+package df_pv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Probe pods
+const (
+	defaultProbeImage     = "busybox:1.36"
+	defaultProbeNamespace = "default"
+	defaultProbeTimeout   = 2 * time.Minute
+	probeContainerName    = "probe"
+	probeMountDir         = "/probe"
+	probeNameLabel        = "app.kubernetes.io/name"
+	probeNameLabelValue   = "df-pv-probe"
+	// probeDeadlineMargin is how much longer than --probe-timeout a probe pod may run before the kubelet stops it
+	probeDeadlineMargin = 30 * time.Second
+)
+
+// addProbeFlags adds the flags of the hostPath probe
+func addProbeFlags(flagSet *pflag.FlagSet, flags *flagpole) {
+	flagSet.BoolVar(&flags.probeHostPath, "probe-hostpath", false, "measure the hostPath and local PVs mounted by running pods with a short-lived privileged pod per node, e.g. for local-path or minikube hostpath provisioners; their size is the capacity of the PV, the one of the file system only when the PV declares none; same as --source probe")
+	flagSet.StringVar(&flags.probeImage, "probe-image", defaultProbeImage, "image of the probe pods; needs sh, seq, df and du")
+	flagSet.StringVar(&flags.probeNamespace, "probe-namespace", defaultProbeNamespace, "namespace to create the probe pods in; it must allow privileged pods")
+	flagSet.DurationVar(&flags.probeTimeout, "probe-timeout", defaultProbeTimeout, "how long to wait for each probe pod to complete, including pulling its image")
+	flagSet.BoolVar(&flags.probeDryRun, "dry-run", false, "with the probe source, print the probe pods that would be created instead of creating them")
+}
+
+// validateProbe validates the --probe-* flags for the selected source
+func (flags *flagpole) validateProbe(source string) error {
+	if flags.probeDryRun && source != sourceProbe {
+		return fmt.Errorf("dry-run needs the %s source", sourceProbe)
+	}
+	if source != sourceProbe {
+		return nil
+	}
+	if flags.probeTimeout <= 0 {
+		return fmt.Errorf("probe-timeout must be positive, got %s", flags.probeTimeout)
+	}
+	return nil
+}
+
+// ProbePodRunner runs a probe pod to completion and returns its logs; the pod is deleted afterwards, whatever happens
+type ProbePodRunner interface {
+	Run(ctx context.Context, pod *corev1.Pod) (string, error)
+}
+
+// clusterProbePodRunner runs probe pods in the cluster
+type clusterProbePodRunner struct {
+	clientset    kubernetes.Interface
+	pollInterval time.Duration
+}
+
+// NewProbePodRunner creates a runner creating the probe pods in the cluster
+func NewProbePodRunner(clientset kubernetes.Interface) ProbePodRunner {
+	return &clusterProbePodRunner{clientset: clientset, pollInterval: time.Second}
+}
+
+func (r *clusterProbePodRunner) Run(ctx context.Context, pod *corev1.Pod) (string, error) {
+	pods := r.clientset.CoreV1().Pods(pod.Namespace)
+	created, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create a probe pod in namespace '%s'", pod.Namespace)
+	}
+	defer r.delete(created)
+	log.Debugf("created probe pod '%s/%s' on node '%s'", created.Namespace, created.Name, created.Spec.NodeName)
+
+	err = wait.PollUntilContextCancel(ctx, r.pollInterval, true, func(ctx context.Context) (bool, error) {
+		current, err := pods.Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return probePodDone(current)
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "probe pod '%s/%s' did not complete", created.Namespace, created.Name)
+	}
+	logs, err := pods.GetLogs(created.Name, &corev1.PodLogOptions{Container: probeContainerName}).DoRaw(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read the logs of probe pod '%s/%s'", created.Namespace, created.Name)
+	}
+	return string(logs), nil
+}
+
+// delete deletes a probe pod even when the collection was cancelled
+func (r *clusterProbePodRunner) delete(pod *corev1.Pod) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	gracePeriod := int64(0)
+	err := r.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Warnf("unable to delete probe pod '%s/%s', delete it with 'kubectl delete pod -n %s %s': %v", pod.Namespace, pod.Name, pod.Namespace, pod.Name, err)
+	}
+}
+
+// probePodDone reports whether a probe pod succeeded, and fails when it failed or cannot start
+func probePodDone(pod *corev1.Pod) (bool, error) {
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, nil
+	case corev1.PodFailed:
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if terminated := containerStatus.State.Terminated; terminated != nil {
+				return false, fmt.Errorf("probe failed with exit code %d: %s %s", terminated.ExitCode, terminated.Reason, strings.TrimSpace(terminated.Message))
+			}
+		}
+		return false, fmt.Errorf("probe failed: %s %s", pod.Status.Reason, pod.Status.Message)
+	}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if waiting := containerStatus.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError":
+				return false, fmt.Errorf("probe cannot start: %s: %s", waiting.Reason, waiting.Message)
+			}
+		}
+	}
+	return false, nil
+}
+
+// probeTarget is a hostPath or local PV mounted by a pod, to be measured on the node of the pod
+type probeTarget struct {
+	pod        *corev1.Pod
+	volumeName string
+	pvcName    string
+	pv         *corev1.PersistentVolume
+	path       string
+}
+
+// HostPathProbeStatsSource measures the hostPath and local PVs the kubelet reports nothing useful for, with a
+// short-lived privileged pod per node reading statvfs with df and the usage of each path with du
+type HostPathProbeStatsSource struct {
+	Clientset       kubernetes.Interface
+	Runner          ProbePodRunner
+	ClaimIndex      *VolumeClaimIndex
+	NamespaceFilter *NamespaceFilter
+	QueryOptions    NodeQueryOptions
+	Image           string
+	Namespace       string
+	Timeout         time.Duration
+
+	// targetsOnNode holds the volumes to measure, found by Nodes
+	targetsOnNode map[string][]probeTarget
+}
+
+// Nodes returns the nodes running pods that mount hostPath or local PVs of volume mode Filesystem in the selected
+// namespaces
+func (s *HostPathProbeStatsSource) Nodes(ctx context.Context) ([]string, error) {
+	podsOnNode, err := ListRunningPodsWithClaimsByNode(ctx, s.Clientset, s.NamespaceFilter)
+	if err != nil {
+		return nil, err
+	}
+	s.targetsOnNode = make(map[string][]probeTarget)
+	for nodeName, pods := range podsOnNode {
+		for i := range pods {
+			pod := &pods[i]
+			for _, podVolume := range pod.Spec.Volumes {
+				if podVolume.PersistentVolumeClaim == nil || podVolume.PersistentVolumeClaim.ClaimName == "" {
+					continue
+				}
+				pvc, err := s.ClaimIndex.GetPVC(ctx, pod.Namespace, podVolume.PersistentVolumeClaim.ClaimName)
+				if apierrors.IsNotFound(errors.Cause(err)) {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+				pv := s.ClaimIndex.GetPV(ctx, pvc.Spec.VolumeName)
+				if pv == nil && s.ClaimIndex.pvsErr != nil {
+					return nil, errors.Wrapf(s.ClaimIndex.pvsErr, "probing needs the PVs")
+				}
+				path := hostPathOfPV(pv)
+				if path == "" {
+					continue
+				}
+				if pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == corev1.PersistentVolumeBlock {
+					// a raw block device is no directory to mount, so the probe pod would wait for it until --probe-timeout
+					log.Warnf("skipping PVC '%s/%s': the probe cannot measure PV '%s' of volume mode Block", pod.Namespace, pvc.Name, pv.Name)
+					continue
+				}
+				s.targetsOnNode[nodeName] = append(s.targetsOnNode[nodeName], probeTarget{pod: pod, volumeName: podVolume.Name, pvcName: pvc.Name, pv: pv, path: path})
+			}
+		}
+	}
+	var sliceOfNodeName []string
+	for nodeName := range s.targetsOnNode {
+		sliceOfNodeName = append(sliceOfNodeName, nodeName)
+	}
+	sort.Strings(sliceOfNodeName)
+	return sliceOfNodeName, nil
+}
+
+// hostPathOfPV returns the path of a hostPath or local PV on its node, empty for any other PV
+func hostPathOfPV(pv *corev1.PersistentVolume) string {
+	switch {
+	case pv == nil:
+		return ""
+	case pv.Spec.HostPath != nil:
+		return pv.Spec.HostPath.Path
+	case pv.Spec.Local != nil:
+		return pv.Spec.Local.Path
+	}
+	return ""
+}
+
+// probePaths returns the distinct paths to measure on a node; the probe pod mounts each one at probeMountDir/<index>
+func probePaths(targets []probeTarget) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if !seen[target.path] {
+			seen[target.path] = true
+			paths = append(paths, target.path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ProbePod returns the probe pod measuring the volumes of a node
+func (s *HostPathProbeStatsSource) ProbePod(nodeName string) *corev1.Pod {
+	paths := probePaths(s.targetsOnNode[nodeName])
+	privileged, automountServiceAccountToken := true, false
+	activeDeadline := s.activeDeadlineSeconds()
+	directory := corev1.HostPathDirectory
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: probeNameLabelValue + "-",
+			Namespace:    s.Namespace,
+			Labels:       map[string]string{probeNameLabel: probeNameLabelValue, "app.kubernetes.io/managed-by": "df-pv"},
+		},
+		Spec: corev1.PodSpec{
+			// bound to the node rather than scheduled, so that it runs even on cordoned or full nodes
+			NodeName:                     nodeName,
+			RestartPolicy:                corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:        &activeDeadline,
+			AutomountServiceAccountToken: &automountServiceAccountToken,
+			Tolerations:                  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:            probeContainerName,
+				Image:           s.Image,
+				Command:         []string{"sh", "-c", probeScript(len(paths))},
+				SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+			}},
+		},
+	}
+	for i, path := range paths {
+		volumeName := fmt.Sprintf("volume-%d", i)
+		// Directory rather than DirectoryOrCreate, so that probing never creates anything on the node; a missing path
+		// keeps the pod from starting until --probe-timeout
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name:         volumeName,
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path, Type: &directory}},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: fmt.Sprintf("%s/%d", probeMountDir, i),
+			ReadOnly:  true,
+		})
+	}
+	return pod
+}
+
+// activeDeadlineSeconds bounds the probe pods by the probe timeout, so that a probe pod df-pv could not clean up,
+// e.g. when interrupted, does not outlive it by much
+func (s *HostPathProbeStatsSource) activeDeadlineSeconds() int64 {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	return int64(math.Ceil((timeout + probeDeadlineMargin).Seconds()))
+}
+
+// probeScript prints df -kP, df -iP and du -sk of each mounted path, each after a "### <index> <command>" line
+func probeScript(paths int) string {
+	return fmt.Sprintf(`for i in $(seq 0 %d); do
+  echo "### $i df"; df -kP %s/$i
+  echo "### $i inodes"; df -iP %s/$i 2>/dev/null
+  echo "### $i du"; du -sk %s/$i 2>/dev/null
+done
+`, paths-1, probeMountDir, probeMountDir, probeMountDir)
+}
+
+// probeSectionPattern matches the lines probeScript prints before the output of each command
+var probeSectionPattern = regexp.MustCompile(`^### ([0-9]+) (df|inodes|du)$`)
+
+// probeResult is what a probe measured for a path; du is in kilobytes
+type probeResult struct {
+	df     *[3]uint64
+	inodes *[3]uint64
+	du     *uint64
+}
+
+// parseProbeOutput parses the output of probeScript by path index; what could not be measured is left nil
+func parseProbeOutput(output string) map[int]*probeResult {
+	sections := make(map[int]map[string]string)
+	var index int
+	var command string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := probeSectionPattern.FindStringSubmatch(line); match != nil {
+			index, _ = strconv.Atoi(match[1])
+			command = match[2]
+			if sections[index] == nil {
+				sections[index] = make(map[string]string)
+			}
+			continue
+		}
+		if command != "" {
+			sections[index][command] += line + "\n"
+		}
+	}
+
+	results := make(map[int]*probeResult)
+	for index, outputs := range sections {
+		result := &probeResult{}
+		if values, err := parseDfOutput(outputs["df"]); err == nil {
+			result.df = &values
+		}
+		if values, err := parseDfOutput(outputs["inodes"]); err == nil {
+			result.inodes = &values
+		}
+		if fields := strings.Fields(outputs["du"]); 0 < len(fields) {
+			if kilobytes, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+				result.du = &kilobytes
+			}
+		}
+		results[index] = result
+	}
+	return results
+}
+
+// probedVolume turns what the probe measured for a PV into a Volume: used is what du counts under the path, and
+// capacity is the one of the PV since such volumes share the file system of the node; available is what is left of
+// it, at most what the file system has left
+func probedVolume(result *probeResult, pv *corev1.PersistentVolume) *Volume {
+	vol := &Volume{
+		CapacityBytes:  int64(result.df[0] * 1024),
+		UsedBytes:      int64(*result.du * 1024),
+		AvailableBytes: int64(result.df[2] * 1024),
+	}
+	if capacity, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok && 0 < capacity.Value() {
+		vol.CapacityBytes = capacity.Value()
+		if left := vol.CapacityBytes - vol.UsedBytes; left < vol.AvailableBytes {
+			vol.AvailableBytes = left
+		}
+		if vol.AvailableBytes < 0 {
+			vol.AvailableBytes = 0
+		}
+	}
+	if result.inodes != nil {
+		vol.Inodes, vol.InodesUsed, vol.InodesFree = result.inodes[0], result.inodes[1], result.inodes[2]
+	}
+	return vol
+}
+
+// Collect runs the probe pods of the nodes using at most QueryOptions.MaxConcurrency workers
+func (s *HostPathProbeStatsSource) Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+	defer close(outputRowPVCChan)
+
+	nodeNameChan := make(chan string, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		nodeNameChan <- nodeName
+	}
+	close(nodeNameChan)
+
+	var workerGroup run.Group
+	var failedNodes nodeErrorRecorder
+	for worker := 0; worker < s.QueryOptions.workers(len(nodeNames)); worker++ {
+		workerGroup.Add(func() error {
+			for nodeName := range nodeNameChan {
+				sliceOfOutputRowPVC, err := s.probeNode(ctx, nodeName)
+				if err != nil {
+					log.Debugf("failed to probe node '%s': %v", nodeName, err)
+					failedNodes.record(nodeName, err)
+				}
+				for _, outputRowPVC := range sliceOfOutputRowPVC {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case outputRowPVCChan <- outputRowPVC:
+					}
+				}
+			}
+			return nil
+		}, func(error) {})
+	}
+	if err := workerGroup.Run(); err != nil {
+		return err
+	}
+	return failedNodes.result(len(nodeNames))
+}
+
+// probeNode runs the probe pod of a node and turns its output into a row per pod mounting a measured volume
+func (s *HostPathProbeStatsSource) probeNode(ctx context.Context, nodeName string) ([]*OutputRowPVC, error) {
+	probeCtx := ctx
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	output, err := s.Runner.Run(probeCtx, s.ProbePod(nodeName))
+	if err != nil {
+		return nil, err
+	}
+	results := parseProbeOutput(output)
+
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	var unmeasured []string
+	paths := probePaths(s.targetsOnNode[nodeName])
+	for _, target := range s.targetsOnNode[nodeName] {
+		result := results[sort.SearchStrings(paths, target.path)]
+		if result == nil || result.df == nil || result.du == nil {
+			unmeasured = append(unmeasured, target.path)
+			continue
+		}
+		vol := probedVolume(result, target.pv)
+		vol.Name = target.volumeName
+		vol.PvcRef.PvcName = target.pvcName
+		vol.PvcRef.PvcNamespace = target.pod.Namespace
+		pod := &Pod{}
+		pod.PodRef.Name = target.pod.Name
+		pod.PodRef.Namespace = target.pod.Namespace
+		outputRowPVC, err := GetOutputRowPVCFromPodAndVolume(ctx, s.ClaimIndex, pod, vol, s.NamespaceFilter)
+		if err != nil {
+			return nil, err
+		}
+		if outputRowPVC == nil {
+			continue
+		}
+		outputRowPVC.NodeName = nodeName
+		outputRowPVC.Source = sourceProbe
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, outputRowPVC)
+	}
+	if 0 < len(unmeasured) {
+		return sliceOfOutputRowPVC, fmt.Errorf("the probe could not measure %s", strings.Join(unmeasured, ", "))
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+// newHostPathProbeStatsSource creates the hostPath probe from the --probe-* flags
+func (flags *flagpole) newHostPathProbeStatsSource(clientset kubernetes.Interface, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter) *HostPathProbeStatsSource {
+	return &HostPathProbeStatsSource{
+		Clientset:       clientset,
+		Runner:          NewProbePodRunner(clientset),
+		ClaimIndex:      claimIndex,
+		NamespaceFilter: namespaceFilter,
+		QueryOptions:    flags.nodeQueryOptions(),
+		Image:           flags.probeImage,
+		Namespace:       flags.probeNamespace,
+		Timeout:         flags.probeTimeout,
+	}
+}
+
+// WriteProbePods writes the probe pods of the nodes as a multi-document yaml stream
+func WriteProbePods(w io.Writer, source *HostPathProbeStatsSource, nodeNames []string) error {
+	for _, nodeName := range nodeNames {
+		manifest, err := yaml.Marshal(source.ProbePod(nodeName))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runProbeDryRun prints the probe pods the probe source would create
+func runProbeDryRun(ctx context.Context, flags *flagpole, w io.Writer) error {
+	ctx, cancel, err := flags.withRequestTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	collection, err := flags.newStatsCollection(ctx)
+	if err != nil {
+		return err
+	}
+	probeSource, ok := collection.source.(*HostPathProbeStatsSource)
+	if !ok {
+		return fmt.Errorf("dry-run needs the %s source, got the %T source", sourceProbe, collection.source)
+	}
+	nodeNames, err := probeSource.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+	if 0 == len(nodeNames) {
+		log.Infof("no running pod mounts a hostPath or local PV; no probe pod would be created")
+	}
+	return WriteProbePods(w, probeSource, nodeNames)
+}
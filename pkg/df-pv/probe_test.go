@@ -0,0 +1,232 @@
+package df_pv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeProbePodRunner answers like probeScript run on nodes where du can only read the paths usedKilobytes lists
+type fakeProbePodRunner struct {
+	usedKilobytes map[string]int
+	pods          []*corev1.Pod
+}
+
+func (r *fakeProbePodRunner) Run(ctx context.Context, pod *corev1.Pod) (string, error) {
+	r.pods = append(r.pods, pod)
+	var output strings.Builder
+	for i, volume := range pod.Spec.Volumes {
+		mountPath := pod.Spec.Containers[0].VolumeMounts[i].MountPath
+		fmt.Fprintf(&output, "### %d df\nFilesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sda1 10485760 4194304 6291456 40%% %s\n", i, mountPath)
+		fmt.Fprintf(&output, "### %d inodes\nFilesystem Inodes IUsed IFree IUse%% Mounted on\n/dev/sda1 1000 250 750 25%% %s\n", i, mountPath)
+		fmt.Fprintf(&output, "### %d du\n", i)
+		if used, ok := r.usedKilobytes[volume.HostPath.Path]; ok {
+			fmt.Fprintf(&output, "%d\t%s\n", used, mountPath)
+		}
+	}
+	return output.String(), nil
+}
+
+func newProbedPV(name string, capacity string, hostPath string, localPath string) *corev1.PersistentVolume {
+	pv := &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if capacity != "" {
+		pv.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)}
+	}
+	if hostPath != "" {
+		pv.Spec.HostPath = &corev1.HostPathVolumeSource{Path: hostPath}
+	}
+	if localPath != "" {
+		pv.Spec.Local = &corev1.LocalVolumeSource{Path: localPath}
+	}
+	return pv
+}
+
+func newBlockPV(pv *corev1.PersistentVolume) *corev1.PersistentVolume {
+	volumeMode := corev1.PersistentVolumeBlock
+	pv.Spec.VolumeMode = &volumeMode
+	return pv
+}
+
+func TestHostPathProbeStatsSource(t *testing.T) {
+	clientset := fake.NewClientset(
+		newPodWithPVC("team-a", "db-0", "node-1", "data-db-0"),
+		newPodWithPVC("team-a", "cache-0", "node-1", "cache"),
+		newPodWithPVC("team-b", "web-0", "node-2", "uploads"),
+		newPodWithPVC("team-b", "static-0", "node-3", "assets"),
+		newPodWithPVC("team-b", "raw-0", "node-4", "raw"),
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "data-db-0"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-db"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cache"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-cache"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "uploads"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-uploads"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "assets"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-assets"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "raw"}, Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-raw"}},
+		newProbedPV("pvc-db", "1Gi", "/opt/local-path-provisioner/pvc-db", ""),
+		newProbedPV("pvc-cache", "", "", "/mnt/disks/ssd0"),
+		newProbedPV("pvc-uploads", "1Gi", "/opt/local-path-provisioner/pvc-uploads", ""),
+		newProbedPV("pvc-assets", "10Gi", "", ""),
+		newBlockPV(newProbedPV("pvc-raw", "10Gi", "", "/dev/disk/by-id/nvme0")),
+	)
+	runner := &fakeProbePodRunner{usedKilobytes: map[string]int{
+		"/opt/local-path-provisioner/pvc-db": 262144,
+		"/mnt/disks/ssd0":                    524288,
+	}}
+	source := &HostPathProbeStatsSource{
+		Clientset:  clientset,
+		Runner:     runner,
+		ClaimIndex: NewVolumeClaimIndex(clientset, ""),
+		Image:      defaultProbeImage,
+		Namespace:  "df-pv",
+	}
+
+	// node-3 only mounts a volume of a CSI driver, which the kubelet reports already, and node-4 a raw block device
+	nodeNames, err := source.Nodes(context.Background())
+	if err != nil || strings.Join(nodeNames, ",") != "node-1,node-2" {
+		t.Fatalf("Nodes = %v, %v, want [node-1 node-2]", nodeNames, err)
+	}
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	collectErrChan := make(chan error, 1)
+	go func() {
+		collectErrChan <- source.Collect(context.Background(), nodeNames, outputRowPVCChan)
+	}()
+	rows := make(map[string]*OutputRowPVC)
+	for row := range outputRowPVCChan {
+		if row.Source != sourceProbe || row.Inodes != 1000 || row.PercentageIUsed != 25 {
+			t.Fatalf("unexpected row: %+v", row)
+		}
+		rows[row.PVName] = row
+	}
+	// the capacity of the PV wins over the one of the file system of the node, which it shares
+	if db := rows["pvc-db"]; db == nil || db.CapacityBytes.Value() != 1<<30 || db.UsedBytes.Value() != 256<<20 || db.AvailableBytes.Value() != 768<<20 || db.NodeName != "node-1" || db.PodName != "db-0" {
+		t.Fatalf("unexpected row for pvc-db: %+v", db)
+	}
+	if cache := rows["pvc-cache"]; cache == nil || cache.CapacityBytes.Value() != 10<<30 || cache.UsedBytes.Value() != 512<<20 || cache.AvailableBytes.Value() != 6<<30 {
+		t.Fatalf("unexpected row for pvc-cache: %+v", cache)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected the rows of pvc-db and pvc-cache, got %v", rows)
+	}
+
+	var nodeCollectionErr *NodeCollectionError
+	if err := <-collectErrChan; !errors.As(err, &nodeCollectionErr) || !nodeCollectionErr.IsPartial() || nodeCollectionErr.FailedNodes[0].NodeName != "node-2" || !strings.Contains(nodeCollectionErr.FailedNodes[0].Message, "could not measure /opt/local-path-provisioner/pvc-uploads") {
+		t.Fatalf("expected node-2 to fail because du cannot read its path, got %v", err)
+	}
+	for _, pod := range runner.pods {
+		if pod.Namespace != "df-pv" || pod.Spec.Containers[0].Image != defaultProbeImage {
+			t.Fatalf("unexpected probe pod: %+v", pod)
+		}
+	}
+}
+
+func TestProbePod(t *testing.T) {
+	source := &HostPathProbeStatsSource{
+		Image:     "registry.example.com/busybox:1.36",
+		Namespace: "df-pv",
+		Timeout:   5 * time.Second,
+		targetsOnNode: map[string][]probeTarget{"node-1": {
+			{path: "/opt/local-path-provisioner/pvc-db"},
+			{path: "/mnt/disks/ssd0"},
+			{path: "/opt/local-path-provisioner/pvc-db"},
+		}},
+	}
+	var manifests bytes.Buffer
+	if err := WriteProbePods(&manifests, source, []string{"node-1"}); err != nil {
+		t.Fatalf("WriteProbePods returned unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(manifests.String(), "---\n") {
+		t.Fatalf("expected a yaml document, got:\n%s", manifests.String())
+	}
+	pod := &corev1.Pod{}
+	if err := yaml.Unmarshal(bytes.TrimPrefix(manifests.Bytes(), []byte("---\n")), pod); err != nil {
+		t.Fatalf("unable to parse the manifest: %v", err)
+	}
+	if pod.Kind != "Pod" || pod.Namespace != "df-pv" || pod.GenerateName != "df-pv-probe-" || pod.Labels[probeNameLabel] != probeNameLabelValue || pod.Spec.NodeName != "node-1" || pod.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Fatalf("unexpected probe pod: %+v", pod)
+	}
+	// a probe pod left behind does not outlive the probe timeout by much
+	if *pod.Spec.ActiveDeadlineSeconds != 35 {
+		t.Fatalf("ActiveDeadlineSeconds = %d, want 35", *pod.Spec.ActiveDeadlineSeconds)
+	}
+	container := pod.Spec.Containers[0]
+	if container.Image != "registry.example.com/busybox:1.36" || !*container.SecurityContext.Privileged || !strings.Contains(container.Command[2], "seq 0 1") {
+		t.Fatalf("unexpected probe container: %+v", container)
+	}
+	// each path is mounted once, read-only and only if it exists
+	if len(pod.Spec.Volumes) != 2 || pod.Spec.Volumes[0].HostPath.Path != "/mnt/disks/ssd0" || *pod.Spec.Volumes[1].HostPath.Type != corev1.HostPathDirectory || container.VolumeMounts[1].MountPath != "/probe/1" || !container.VolumeMounts[1].ReadOnly {
+		t.Fatalf("unexpected probe volumes: %+v %+v", pod.Spec.Volumes, container.VolumeMounts)
+	}
+}
+
+func TestProbePodRunner(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  corev1.PodStatus
+		wantErr string
+	}{
+		{name: "succeeded", status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+		{
+			name:    "image pull failure",
+			status:  corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{{Name: probeContainerName, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}}}}},
+			wantErr: "probe cannot start: ImagePullBackOff",
+		},
+		{
+			name:    "failed",
+			status:  corev1.PodStatus{Phase: corev1.PodFailed, ContainerStatuses: []corev1.ContainerStatus{{Name: probeContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}}}},
+			wantErr: "exit code 1",
+		},
+	} {
+		clientset := fake.NewClientset()
+		// the fake clientset neither generates names nor runs pods
+		clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+			pod.Name = pod.GenerateName + "abcde"
+			pod.Status = tc.status
+			return false, nil, nil
+		})
+		runner := &clusterProbePodRunner{clientset: clientset, pollInterval: time.Millisecond}
+		pod := (&HostPathProbeStatsSource{Image: defaultProbeImage, Namespace: "df-pv"}).ProbePod("node-1")
+
+		logs, err := runner.Run(context.Background(), pod)
+		if tc.wantErr == "" && (err != nil || logs != "fake logs") {
+			t.Fatalf("%s: Run = %q, %v, want the logs of the pod", tc.name, logs, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Fatalf("%s: Run error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+		pods, err := clientset.CoreV1().Pods("df-pv").List(context.Background(), metav1.ListOptions{})
+		if err != nil || len(pods.Items) != 0 {
+			t.Fatalf("%s: expected the probe pod to be deleted, got %v, %v", tc.name, pods, err)
+		}
+	}
+}
+
+func TestValidateProbe(t *testing.T) {
+	for _, tc := range []struct {
+		flags   flagpole
+		wantErr string
+	}{
+		{flags: flagpole{}},
+		{flags: flagpole{probeHostPath: true, probeTimeout: time.Minute}},
+		{flags: flagpole{probeHostPath: true, probeTimeout: time.Minute, probeDryRun: true}},
+		{flags: flagpole{source: sourceProbe, probeTimeout: time.Minute, probeDryRun: true}},
+		{flags: flagpole{probeDryRun: true}, wantErr: "dry-run needs the probe source"},
+		{flags: flagpole{probeHostPath: true, probeTimeout: time.Minute, source: sourceExec}, wantErr: "cannot be combined"},
+		{flags: flagpole{probeHostPath: true, probeTimeout: time.Minute, kubeletDirect: true}, wantErr: "cannot be combined"},
+		{flags: flagpole{probeHostPath: true}, wantErr: "probe-timeout must be positive"},
+	} {
+		err := tc.flags.validateSource()
+		if (tc.wantErr == "" && err != nil) || (tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr))) {
+			t.Fatalf("%+v.validateSource() = %v, want %q", tc.flags, err, tc.wantErr)
+		}
+	}
+}
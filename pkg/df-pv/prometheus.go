@@ -0,0 +1,148 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPrometheusNodeLabel is the label the kube-prometheus relabeling adds to the kubelet volume stats series to
+// tell their node; setups without that relabeling only have the instance label, i.e. the kubelet's address
+const defaultPrometheusNodeLabel = "node"
+
+// prometheusLabelNamePattern matches the label names that can be used unquoted in PromQL
+var prometheusLabelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// PrometheusStatsSource reads the kubelet_volume_stats_* series scraped by Prometheus, for users who may not proxy to
+// the nodes
+type PrometheusStatsSource struct {
+	API promv1.API
+	// NodeLabel is the label of the series telling their node
+	NodeLabel       string
+	ClaimIndex      *VolumeClaimIndex
+	NamespaceFilter *NamespaceFilter
+}
+
+// NewPrometheusStatsSource creates a source querying the Prometheus HTTP API at prometheusURL, telling the node of
+// the series by nodeLabel
+func NewPrometheusStatsSource(prometheusURL string, nodeLabel string, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter) (*PrometheusStatsSource, error) {
+	client, err := promapi.NewClient(promapi.Config{Address: prometheusURL})
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid prometheus-url %q", prometheusURL)
+	}
+	return &PrometheusStatsSource{
+		API:             promv1.NewAPI(client),
+		NodeLabel:       nodeLabel,
+		ClaimIndex:      claimIndex,
+		NamespaceFilter: namespaceFilter,
+	}, nil
+}
+
+// Nodes returns the nodes Prometheus has volume stats of; series without the node label cannot be told apart, so
+// they are skipped with a warning
+func (s *PrometheusStatsSource) Nodes(ctx context.Context) ([]string, error) {
+	vector, err := s.query(ctx, fmt.Sprintf("count by (%s) (%s%s)", s.NodeLabel, volumeStatsSeries[0].name, s.selector()))
+	if err != nil {
+		return nil, err
+	}
+	var sliceOfNodeName []string
+	for _, sample := range vector {
+		nodeName := string(sample.Metric[model.LabelName(s.NodeLabel)])
+		if nodeName == "" {
+			log.Warnf("skipping the %s series without a %q label; choose the label telling their node with --prometheus-node-label, e.g. instance", volumeStatsSeries[0].name, s.NodeLabel)
+			continue
+		}
+		sliceOfNodeName = append(sliceOfNodeName, nodeName)
+	}
+	sort.Strings(sliceOfNodeName)
+	return sliceOfNodeName, nil
+}
+
+// Collect queries every volume stats series once and turns the series of each PVC and node into a row; Prometheus
+// knows the nodes but not the pods mounting the volumes
+func (s *PrometheusStatsSource) Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+	defer close(outputRowPVCChan)
+
+	queriedNodes := make(map[string]struct{}, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		queriedNodes[nodeName] = struct{}{}
+	}
+	var samples volumeStatsSamples
+	for _, series := range volumeStatsSeries {
+		vector, err := s.query(ctx, series.name+s.selector())
+		if err != nil {
+			return err
+		}
+		for _, sample := range vector {
+			nodeName := string(sample.Metric[model.LabelName(s.NodeLabel)])
+			if _, ok := queriedNodes[nodeName]; !ok {
+				continue
+			}
+			samples.add(series.name, string(sample.Metric[volumeStatsNamespaceLabel]), string(sample.Metric[volumeStatsPVCLabel]), nodeName, float64(sample.Value))
+		}
+	}
+
+	sliceOfOutputRowPVC, err := samples.outputRows(ctx, s.claimIndex(ctx), s.NamespaceFilter)
+	if err != nil {
+		return err
+	}
+	for _, outputRowPVC := range sliceOfOutputRowPVC {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case outputRowPVCChan <- outputRowPVC:
+		}
+	}
+	return nil
+}
+
+// claimIndex returns the index to enrich the rows with; the PVCs only add their PV and storage details, so a user
+// who may not list them, or whose API server cannot be reached, still gets what Prometheus knows
+func (s *PrometheusStatsSource) claimIndex(ctx context.Context) *VolumeClaimIndex {
+	if err := s.ClaimIndex.load(ctx); err != nil {
+		log.Warnf("unable to list PVCs, continuing with the Prometheus data only: %v", err)
+		return NewStaticVolumeClaimIndex(nil, nil)
+	}
+	return s.ClaimIndex
+}
+
+// selector restricts the series to PVCs, and to the included namespaces when there are some; exclusions are applied
+// to the rows
+func (s *PrometheusStatsSource) selector() string {
+	matchers := []string{fmt.Sprintf(`%s!=""`, volumeStatsPVCLabel)}
+	if s.NamespaceFilter != nil && s.NamespaceFilter.Include != nil {
+		var namespaces []string
+		for namespace := range s.NamespaceFilter.Include {
+			namespaces = append(namespaces, regexp.QuoteMeta(namespace))
+		}
+		sort.Strings(namespaces)
+		matchers = append(matchers, fmt.Sprintf("%s=~%q", volumeStatsNamespaceLabel, strings.Join(namespaces, "|")))
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// query runs an instant query that must return a vector
+func (s *PrometheusStatsSource) query(ctx context.Context, query string) (model.Vector, error) {
+	log.Debugf("querying prometheus: %s", query)
+	value, warnings, err := s.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, errors.Wrapf(err, "prometheus query %q failed", query)
+	}
+	for _, warning := range warnings {
+		log.Warnf("prometheus query %q: %s", query, warning)
+	}
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil, errors.Errorf("prometheus query %q returned a %s instead of a vector", query, value.Type())
+	}
+	return vector, nil
+}
@@ -0,0 +1,226 @@
+package df_pv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fakePrometheus serves instant queries of the kubelet volume stats series; every series has the same value on all
+// the volumes, and count by (<label>) queries return the values of that label on the capacity series
+type fakePrometheus struct {
+	mu      sync.Mutex
+	volumes []map[string]string
+	values  map[string]float64
+	queries []string
+}
+
+func (p *fakePrometheus) serve(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" || r.ParseForm() != nil {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.Form.Get("query")
+		p.mu.Lock()
+		p.queries = append(p.queries, query)
+		p.mu.Unlock()
+
+		var result []map[string]interface{}
+		if strings.HasPrefix(query, "count by (") {
+			label := strings.SplitN(strings.TrimPrefix(query, "count by ("), ")", 2)[0]
+			values := make(map[string]bool)
+			for _, labels := range p.volumes {
+				if !values[labels[label]] {
+					values[labels[label]] = true
+					metric := map[string]string{}
+					if labels[label] != "" {
+						metric[label] = labels[label]
+					}
+					result = append(result, map[string]interface{}{"metric": metric, "value": []interface{}{1, "1"}})
+				}
+			}
+		} else {
+			name := strings.SplitN(query, "{", 2)[0]
+			for _, labels := range p.volumes {
+				metric := map[string]string{"__name__": name}
+				for label, value := range labels {
+					metric[label] = value
+				}
+				result = append(result, map[string]interface{}{"metric": metric, "value": []interface{}{1, fmt.Sprint(p.values[name])}})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "vector", "result": result},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func collectFromSource(t *testing.T, source StatsSource) []*OutputRowPVC {
+	t.Helper()
+
+	nodeNames, err := source.Nodes(context.Background())
+	if err != nil {
+		t.Fatalf("Nodes returned unexpected error: %v", err)
+	}
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	collectErrChan := make(chan error, 1)
+	go func() {
+		collectErrChan <- source.Collect(context.Background(), nodeNames, outputRowPVCChan)
+	}()
+	sliceOfOutputRowPVC := ConsumeOutputRowsConcurrently(outputRowPVCChan)
+	if err := <-collectErrChan; err != nil {
+		t.Fatalf("Collect returned unexpected error: %v", err)
+	}
+	sort.Slice(sliceOfOutputRowPVC, func(i, j int) bool {
+		return sliceOfOutputRowPVC[i].PVCName+sliceOfOutputRowPVC[i].NodeName < sliceOfOutputRowPVC[j].PVCName+sliceOfOutputRowPVC[j].NodeName
+	})
+	return sliceOfOutputRowPVC
+}
+
+func newTestFakePrometheus() *fakePrometheus {
+	return &fakePrometheus{
+		volumes: []map[string]string{
+			{"namespace": "team-a", "persistentvolumeclaim": "data-db-0", "node": "node-1"},
+			{"namespace": "team-a", "persistentvolumeclaim": "deleted", "node": "node-1"},
+			{"namespace": "team-b", "persistentvolumeclaim": "uploads", "node": "node-2"},
+			{"namespace": "team-b", "persistentvolumeclaim": "uploads", "node": "node-3"},
+		},
+		values: map[string]float64{
+			"kubelet_volume_stats_capacity_bytes":  1000,
+			"kubelet_volume_stats_used_bytes":      250,
+			"kubelet_volume_stats_available_bytes": 750,
+			"kubelet_volume_stats_inodes":          100,
+			"kubelet_volume_stats_inodes_used":     10,
+			"kubelet_volume_stats_inodes_free":     90,
+		},
+	}
+}
+
+func TestPrometheusStatsSource(t *testing.T) {
+	prometheus := newTestFakePrometheus()
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		pvcs: []corev1.PersistentVolumeClaim{newBoundPVC("team-a", "data-db-0", "pvc-db"), newBoundPVC("team-b", "uploads", "pvc-uploads")},
+	})
+	source, err := NewPrometheusStatsSource(prometheus.serve(t), defaultPrometheusNodeLabel, NewVolumeClaimIndex(clientset, ""), nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusStatsSource returned unexpected error: %v", err)
+	}
+
+	rows := collectFromSource(t, source)
+	if len(rows) != 3 {
+		t.Fatalf("expected the stats of the deleted PVC to be skipped, got %d rows", len(rows))
+	}
+	db := rows[0]
+	if db.Namespace != "team-a" || db.PVCName != "data-db-0" || db.PVName != "pvc-db" || db.NodeName != "node-1" || db.PodName != "" {
+		t.Fatalf("unexpected row: %+v", db)
+	}
+	if db.CapacityBytes.Value() != 1000 || db.UsedBytes.Value() != 250 || db.AvailableBytes.Value() != 750 || db.PercentageUsed != 25 {
+		t.Fatalf("unexpected bytes: %s used of %s, %s available, %f%%", db.UsedBytes, db.CapacityBytes, db.AvailableBytes, db.PercentageUsed)
+	}
+	if db.Inodes != 100 || db.InodesUsed != 10 || db.InodesFree != 90 || db.PercentageIUsed != 10 {
+		t.Fatalf("unexpected inodes: %d used of %d, %d free", db.InodesUsed, db.Inodes, db.InodesFree)
+	}
+	if rows[1].NodeName != "node-2" || rows[2].NodeName != "node-3" || rows[2].PVName != "pvc-uploads" {
+		t.Fatalf("expected a row per node mounting uploads, got %+v and %+v", rows[1], rows[2])
+	}
+	if deduped := DeduplicateOutputRows(rows); len(deduped) != 2 {
+		t.Fatalf("expected the rows of uploads to be deduplicated, got %d rows", len(deduped))
+	}
+}
+
+func TestPrometheusStatsSourceWithInstanceNodeLabel(t *testing.T) {
+	prometheus := newTestFakePrometheus()
+	for _, labels := range prometheus.volumes {
+		labels["instance"] = labels["node"] + ":10250"
+		delete(labels, "node")
+	}
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		pvcs: []corev1.PersistentVolumeClaim{newBoundPVC("team-a", "data-db-0", "pvc-db"), newBoundPVC("team-b", "uploads", "pvc-uploads")},
+	})
+	url := prometheus.serve(t)
+
+	source, err := NewPrometheusStatsSource(url, defaultPrometheusNodeLabel, NewVolumeClaimIndex(clientset, ""), nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusStatsSource returned unexpected error: %v", err)
+	}
+	if nodeNames, err := source.Nodes(context.Background()); err != nil || len(nodeNames) != 0 {
+		t.Fatalf("expected the series without a node label to be skipped, got %v, %v", nodeNames, err)
+	}
+
+	source, err = NewPrometheusStatsSource(url, "instance", NewVolumeClaimIndex(clientset, ""), nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusStatsSource returned unexpected error: %v", err)
+	}
+	rows := collectFromSource(t, source)
+	if len(rows) != 3 || rows[0].NodeName != "node-1:10250" || rows[2].NodeName != "node-3:10250" {
+		t.Fatalf("expected the rows to be told apart by instance, got %d rows", len(rows))
+	}
+}
+
+func TestPrometheusStatsSourceWithoutPVCAccess(t *testing.T) {
+	for _, response := range []struct {
+		code   int
+		reason string
+	}{
+		{code: http.StatusForbidden, reason: "Forbidden"},
+		{code: http.StatusInternalServerError, reason: "InternalError"},
+	} {
+		prometheus := newTestFakePrometheus()
+		clientset := newHandlerClientset(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(response.code)
+			_, _ = fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":%q,"code":%d}`, response.reason, response.code)
+		})
+		namespaceFilter, err := NewNamespaceFilter("team-b", nil)
+		if err != nil {
+			t.Fatalf("NewNamespaceFilter returned unexpected error: %v", err)
+		}
+		source, err := NewPrometheusStatsSource(prometheus.serve(t), defaultPrometheusNodeLabel, NewVolumeClaimIndex(clientset, "team-b"), namespaceFilter)
+		if err != nil {
+			t.Fatalf("NewPrometheusStatsSource returned unexpected error: %v", err)
+		}
+
+		// the stand-in ignores the selector, so the namespace is also filtered from the rows
+		rows := collectFromSource(t, source)
+		if len(rows) != 2 || rows[0].PVCName != "uploads" || rows[0].PVName != "" || rows[0].UsedBytes.Value() != 250 {
+			t.Fatalf("expected the rows of team-b without their PV when listing PVCs fails with %d, got %d rows", response.code, len(rows))
+		}
+		for _, query := range prometheus.queries {
+			if !strings.Contains(query, `namespace=~"team-b"`) {
+				t.Fatalf("expected every query to select team-b, got %q", query)
+			}
+		}
+	}
+}
+
+func TestPrometheusSourceFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"--source", "prometheus"}, wantErr: "needs prometheus-url"},
+		{args: []string{"--prometheus-url", "http://prometheus:9090"}, wantErr: "can only be used with the prometheus source"},
+		{args: []string{"--prometheus-node-label", "instance"}, wantErr: "prometheus-node-label can only be used with the prometheus source"},
+		{args: []string{"--source", "prometheus", "--prometheus-url", "http://prometheus:9090", "--prometheus-node-label", "node name"}, wantErr: "invalid prometheus-node-label"},
+		{args: []string{"--from-dir", "testdata/dump", "--source", "prometheus", "--prometheus-url", "http://prometheus:9090"}, wantErr: "can only be used with the files source"},
+	} {
+		if _, err := executeRootCommand(t, tc.args...); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("df-pv %v error = %v, want %q", tc.args, err, tc.wantErr)
+		}
+	}
+}
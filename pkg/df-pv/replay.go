@@ -0,0 +1,207 @@
+package df_pv
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Layout of a dump, as written by the dump subcommand
+const (
+	dumpNodesDir = "nodes"
+	dumpPVCsFile = "persistentvolumeclaims.json"
+	dumpPVsFile  = "persistentvolumes.json"
+)
+
+// addSourceFlags adds the flags choosing where the volume stats are collected from
+func addSourceFlags(flagSet *pflag.FlagSet, flags *flagpole) {
+	flagSet.StringVar(&flags.source, "source", "", fmt.Sprintf("where to collect the volume stats from; one of [%s] (default %s, or %s with --from-file or --from-dir)", strings.Join(availableSources, ", "), sourceNodeProxy, sourceFiles))
+	flagSet.StringArrayVar(&flags.fromFiles, "from-file", nil, "read the stats/summary response of a node from a file instead of querying the cluster (e.g. saved with 'kubectl get --raw /api/v1/nodes/<node>/proxy/stats/summary'); can be repeated")
+	flagSet.StringVar(&flags.fromDir, "from-dir", "", "read the stats/summary responses and the PVCs and PVs from a directory or tarball written by 'df-pv dump' instead of querying the cluster")
+	flagSet.StringVar(&flags.prometheusURL, "prometheus-url", "", fmt.Sprintf("base URL of the Prometheus HTTP API scraping the kubelets, for the %s source (e.g. http://prometheus.monitoring:9090)", sourcePrometheus))
+	flagSet.StringVar(&flags.prometheusNodeLabel, "prometheus-node-label", defaultPrometheusNodeLabel, fmt.Sprintf("label of the kubelet volume stats series telling their node, for the %s source; e.g. instance when Prometheus does not relabel them with the node name", sourcePrometheus))
+}
+
+// isOffline reports whether the volume stats are replayed from files instead of queried from a cluster
+func (flags *flagpole) isOffline() bool {
+	return 0 < len(flags.fromFiles) || flags.fromDir != ""
+}
+
+// NodeSummary is the raw stats/summary response of a node
+type NodeSummary struct {
+	NodeName string
+	Summary  []byte
+}
+
+// Dump holds the stats/summary responses of the nodes of a cluster along with its PVCs and PVs; the lists are nil
+// when they were not captured
+type Dump struct {
+	NodeSummaries []NodeSummary
+	PVCs          *corev1.PersistentVolumeClaimList
+	PVs           *corev1.PersistentVolumeList
+}
+
+// ReadNodeSummaries reads the stats/summary responses stored in a file; a file may hold the responses of several
+// nodes one after the other, as hack/kubedf.sh fetches them. The node name is read from each response, falling back
+// to the file name
+func ReadNodeSummaries(fileName string) ([]NodeSummary, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s", fileName)
+	}
+	summaries, err := parseNodeSummaries(content, strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName)))
+	return summaries, errors.Wrapf(err, "unable to read %s", fileName)
+}
+
+func parseNodeSummaries(content []byte, defaultNodeName string) ([]NodeSummary, error) {
+	var summaries []NodeSummary
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for {
+		var summary json.RawMessage
+		if err := decoder.Decode(&summary); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "invalid stats/summary response")
+		}
+		var response ServerResponseStruct
+		if err := json.Unmarshal(summary, &response); err != nil {
+			return nil, errors.Wrapf(err, "invalid stats/summary response")
+		}
+		nodeName := response.Node.NodeName
+		if nodeName == "" {
+			nodeName = defaultNodeName
+		}
+		summaries = append(summaries, NodeSummary{NodeName: nodeName, Summary: summary})
+	}
+	return summaries, nil
+}
+
+// ReadDump reads a dump from a directory, or from the tarball written by the dump subcommand
+func ReadDump(dumpPath string) (*Dump, error) {
+	info, err := os.Stat(dumpPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read dump")
+	}
+	var files map[string][]byte
+	if info.IsDir() {
+		files, err = readDumpDir(dumpPath)
+	} else {
+		files, err = readDumpTarball(dumpPath)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read dump %s", dumpPath)
+	}
+
+	// node summaries are stored under nodes/, or directly next to the lists
+	dump := &Dump{}
+	var fileNames []string
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		switch path.Base(fileName) {
+		case dumpPVCsFile:
+			dump.PVCs = &corev1.PersistentVolumeClaimList{}
+			err = json.Unmarshal(files[fileName], dump.PVCs)
+		case dumpPVsFile:
+			dump.PVs = &corev1.PersistentVolumeList{}
+			err = json.Unmarshal(files[fileName], dump.PVs)
+		default:
+			var summaries []NodeSummary
+			summaries, err = parseNodeSummaries(files[fileName], strings.TrimSuffix(path.Base(fileName), ".json"))
+			dump.NodeSummaries = append(dump.NodeSummaries, summaries...)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read %s", fileName)
+		}
+	}
+	return dump, nil
+}
+
+// readDumpDir reads the json files of a directory and of its nodes subdirectory
+func readDumpDir(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, pattern := range []string{"*.json", path.Join(dumpNodesDir, "*.json")} {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			content, err := os.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+			relativePath, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			files[filepath.ToSlash(relativePath)] = content
+		}
+	}
+	return files, nil
+}
+
+// readDumpTarball reads the files of a gzipped tarball
+func readDumpTarball(tarballPath string) (map[string][]byte, error) {
+	tarball, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, err
+	}
+	defer tarball.Close()
+	gzipReader, err := gzip.NewReader(tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".json" {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(strings.TrimPrefix(header.Name, "./"))] = content
+	}
+}
+
+// readDump reads the files given by --from-dir and --from-file
+func (flags *flagpole) readDump() (*Dump, error) {
+	dump := &Dump{}
+	if flags.fromDir != "" {
+		var err error
+		if dump, err = ReadDump(flags.fromDir); err != nil {
+			return nil, err
+		}
+	}
+	for _, fileName := range flags.fromFiles {
+		summaries, err := ReadNodeSummaries(fileName)
+		if err != nil {
+			return nil, err
+		}
+		dump.NodeSummaries = append(dump.NodeSummaries, summaries...)
+	}
+	return dump, nil
+}
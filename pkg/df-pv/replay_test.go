@@ -0,0 +1,154 @@
+package df_pv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// executeRootCommand runs df-pv with the given arguments and returns what it printed on stdout
+func executeRootCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	rootCmd := setupRootCommand()
+	rootCmd.SetArgs(args)
+	var executeErr error
+	output := captureStdout(t, func() {
+		executeErr = rootCmd.Execute()
+	})
+	return output, executeErr
+}
+
+func TestReplayDumpDir(t *testing.T) {
+	output, err := executeRootCommand(t, "--from-dir", "testdata/dump", "-o", "csv", "--columns", "namespace,pvc,pv,node,pod,storageclass,size,used")
+	if err != nil {
+		t.Fatalf("df-pv --from-dir returned unexpected error: %v", err)
+	}
+	want := "namespace,pvc,pv,node,pod,storageclass,size,used\n" +
+		"db,data-db-0,pvc-db,node-1,db-0,gp3,10737418240,8589934592\n" +
+		"web,uploads,pvc-uploads,node-2,web-7d4b9c-x2x9k,efs,5368709120,1073741824\n"
+	if output != want {
+		t.Fatalf("df-pv --from-dir output =\n%s\nwant\n%s", output, want)
+	}
+
+	output, err = executeRootCommand(t, "--from-dir", "testdata/dump", "-n", "web", "--all", "-o", "csv", "--columns", "pvc,status,size,used")
+	if err != nil {
+		t.Fatalf("df-pv --from-dir --all returned unexpected error: %v", err)
+	}
+	if want := "pvc,status,size,used\nscratch,Pending,1073741824,\nuploads,Bound,5368709120,1073741824\n"; output != want {
+		t.Fatalf("df-pv --from-dir --all output =\n%s\nwant\n%s", output, want)
+	}
+
+	output, err = executeRootCommand(t, "--from-dir", "testdata/dump", "--orphans", "-o", "csv", "--columns", "pv,status,pvc")
+	if err != nil {
+		t.Fatalf("df-pv --from-dir --orphans returned unexpected error: %v", err)
+	}
+	if want := "pv,status,pvc\npvc-old,Released,data-db-1\n"; output != want {
+		t.Fatalf("df-pv --from-dir --orphans output =\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestReplayConcatenatedSummariesWithoutClaims(t *testing.T) {
+	var content []byte
+	for _, nodeName := range []string{"node-1", "node-2"} {
+		summary, err := os.ReadFile(filepath.Join("testdata", "dump", "nodes", nodeName+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, summary...)
+	}
+	fileName := filepath.Join(t.TempDir(), "summaries.json")
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := ReadNodeSummaries(fileName)
+	if err != nil {
+		t.Fatalf("ReadNodeSummaries returned unexpected error: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].NodeName != "node-1" || summaries[1].NodeName != "node-2" {
+		t.Fatalf("unexpected summaries: %+v", summaries)
+	}
+
+	// without the PVCs, the volumes are listed without their PV
+	output, err := executeRootCommand(t, "--from-file", fileName, "-o", "csv", "--columns", "pvc,pv,node")
+	if err != nil {
+		t.Fatalf("df-pv --from-file returned unexpected error: %v", err)
+	}
+	if want := "pvc,pv,node\ndata-db-0,,node-1\nuploads,,node-2\n"; output != want {
+		t.Fatalf("df-pv --from-file output =\n%s\nwant\n%s", output, want)
+	}
+
+	if _, err := executeRootCommand(t, "--from-file", fileName, "--namespace-selector", "team=db"); err == nil || !strings.Contains(err.Error(), "namespace-selector") {
+		t.Fatalf("expected namespace-selector to be rejected when replaying, got %v", err)
+	}
+}
+
+func TestWriteDumpRoundTrip(t *testing.T) {
+	dump, err := ReadDump(filepath.Join("testdata", "dump"))
+	if err != nil {
+		t.Fatalf("ReadDump returned unexpected error: %v", err)
+	}
+	if len(dump.NodeSummaries) != 2 || dump.PVCs == nil || len(dump.PVCs.Items) != 3 || dump.PVs == nil || len(dump.PVs.Items) != 3 {
+		t.Fatalf("unexpected dump: %d summaries, pvcs=%v, pvs=%v", len(dump.NodeSummaries), dump.PVCs, dump.PVs)
+	}
+
+	tarballName := filepath.Join(t.TempDir(), "dump.tar.gz")
+	if err := saveDump(tarballName, dump, time.Now()); err != nil {
+		t.Fatalf("saveDump returned unexpected error: %v", err)
+	}
+
+	replayed, err := ReadDump(tarballName)
+	if err != nil {
+		t.Fatalf("ReadDump of the tarball returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, dump) {
+		t.Fatalf("the tarball does not replay the dump it was written from")
+	}
+
+	// a dump that cannot be saved completely must not be reported as saved
+	if _, err := os.Stat("/dev/full"); err == nil {
+		if err := saveDump("/dev/full", dump, time.Now()); err == nil || !strings.Contains(err.Error(), "unable to write dump") {
+			t.Fatalf("saveDump to a full device = %v, want a write error", err)
+		}
+	}
+	if err := saveDump(filepath.Join(t.TempDir(), "missing", "dump.tar.gz"), dump, time.Now()); err == nil || !strings.Contains(err.Error(), "unable to create dump") {
+		t.Fatalf("saveDump to a missing directory = %v, want a create error", err)
+	}
+}
+
+func TestGetStatsSummariesFromNodes(t *testing.T) {
+	cluster := &fakeCluster{
+		nodeSummaries:  map[string]string{"node-b": `{"pods":[]}`, "node-a": `{"pods":[]}`},
+		nodeStatusCode: map[string]int{"node-c": 403},
+	}
+	clientset := newFakeClusterClientset(t, cluster)
+
+	summaries, err := GetStatsSummariesFromNodes(context.Background(), clientset, []string{"node-b", "node-c", "node-a"}, NodeQueryOptions{MaxConcurrency: 2})
+	var nodeCollectionErr *NodeCollectionError
+	if !errors.As(err, &nodeCollectionErr) || len(nodeCollectionErr.FailedNodes) != 1 || nodeCollectionErr.FailedNodes[0].NodeName != "node-c" {
+		t.Fatalf("expected node-c to fail, got %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].NodeName != "node-a" || summaries[1].NodeName != "node-b" {
+		t.Fatalf("unexpected summaries: %+v", summaries)
+	}
+}
+
+func TestOnlyCommandsEvaluatingAnnotationsHaveIgnoreAnnotationsFlag(t *testing.T) {
+	rootCmd := setupRootCommand()
+	for _, args := range [][]string{nil, {"check"}, {"serve"}, {"dump"}} {
+		cmd, _, err := rootCmd.Find(args)
+		if err != nil {
+			t.Fatalf("Find(%v) returned unexpected error: %v", args, err)
+		}
+		if hasFlag := cmd.Flags().Lookup("ignore-annotations") != nil; hasFlag != (cmd.Name() != "serve" && cmd.Name() != "dump") {
+			t.Fatalf("%s has --ignore-annotations: %t", cmd.Name(), hasFlag)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package df_pv
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	// "github.com/fatih/color"
 	// "github.com/gookit/color"
@@ -19,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/yashbhutwala/kubectl-df-pv/pkg/version"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -26,6 +31,7 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // IEC (binary) byte size constants for readability
@@ -48,16 +54,66 @@ const (
 func InitAndExecute() {
 	rootCmd := setupRootCommand()
 	if err := errors.Wrapf(rootCmd.Execute(), "run df-pv root command"); err != nil {
+		// the command reported the failure itself, e.g. by listing the failed nodes
+		var exitCodeErr *ExitCodeError
+		if errors.As(err, &exitCodeErr) {
+			os.Exit(exitCodeErr.Code)
+		}
 		log.Fatalf("unable to run root command: %+v", err)
 		os.Exit(1)
 	}
 }
 
 type flagpole struct {
-	logLevel              string
-	genericCliConfigFlags *genericclioptions.ConfigFlags
-	disableColor          bool
-	columns               string
+	logLevel               string
+	genericCliConfigFlags  *genericclioptions.ConfigFlags
+	disableColor           bool
+	columns                string
+	output                 string
+	noHeaders              bool
+	sortBy                 string
+	reverse                bool
+	severity               string
+	minUsed                float64
+	maxUsed                float64
+	warnThreshold          float64
+	criticalThreshold      float64
+	inodeWarnThreshold     float64
+	inodeCriticalThreshold float64
+	excludeNamespaces      []string
+	namespaceSelector      string
+	maxConcurrency         int
+	nodeTimeout            time.Duration
+	nodeRetries            int
+	watch                  bool
+	interval               time.Duration
+	listenAddress          string
+	metricsPath            string
+	scrapeInterval         time.Duration
+	warnAbove              float64
+	failAbove              float64
+	inodeWarnAbove         float64
+	inodeFailAbove         float64
+	ignoreAnnotations      bool
+	groupBy                string
+	summary                bool
+	perMount               bool
+	all                    bool
+	orphans                bool
+	source                 string
+	fromFiles              []string
+	fromDir                string
+	dumpFile               string
+	prometheusURL          string
+	prometheusNodeLabel    string
+	kubeletDirect          bool
+	kubeletCAFile          string
+	kubeletInsecure        bool
+	probeHostPath          bool
+	probeImage             string
+	probeNamespace         string
+	probeTimeout           time.Duration
+	probeDryRun            bool
 }
 
 func setupRootCommand() *cobra.Command {
@@ -67,10 +123,19 @@ func setupRootCommand() *cobra.Command {
 		Short: "df-pv emulates Unix style df for persistent volumes",
 		Long: `df-pv emulates Unix style df for persistent volumes w/ ability to filter by namespace
 
+Several namespaces can be selected at once with a comma separated list (e.g. -n team-a,team-b), excluded with --exclude-namespace, or chosen by label with --namespace-selector
+
+With --watch it keeps refreshing every --interval and shows how much each volume grew (delta) and how fast (rate)
+
+If some nodes cannot be queried, the volumes from the remaining nodes are still printed, the failed nodes are listed on stderr and the exit code is 2 (partial results); the exit code is 1 when no node could be queried
+
 It autoconverts all "sizes" to IEC values (see: https://en.wikipedia.org/wiki/Binary_prefix and https://kubernetes.io/docs/concepts/configuration/manage-resources-containers/#meaning-of-memory)
 
-It colors the values based on "severity" [red: > 75% (too high); yellow: < 25% (too low); green: >= 25 and <= 75 (OK)]`,
-		Args: cobra.MaximumNArgs(0),
+It colors the values based on "severity" [red: > 75% (critical); yellow: >= 25% and <= 75% (warning); green: < 25% (OK)]
+The thresholds are configurable via --warn-threshold and --critical-threshold (--inode-warn-threshold and --inode-critical-threshold for inode columns)`,
+		Args:          cobra.MaximumNArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runRootCommand(flags)
 		},
@@ -89,16 +154,192 @@ It colors the values based on "severity" [red: > 75% (too high); yellow: < 25% (
 	rootCmd.PersistentFlags().StringVarP(&flags.logLevel, "verbosity", "v", "info", "log level; one of [info, debug, trace, warn, error, fatal, panic]")
 	rootCmd.Flags().BoolVarP(&flags.disableColor, "disable-color", "d", false, "boolean flag for disabling colored output")
 	rootCmd.Flags().StringVar(&flags.columns, "columns", "", "comma separated list of columns to show")
-
-	flags.genericCliConfigFlags = genericclioptions.NewConfigFlags(false)
-	flags.genericCliConfigFlags.AddFlags(rootCmd.Flags())
+	rootCmd.Flags().StringVarP(&flags.output, "output", "o", outputFormatTable, "output format; one of [table, json, yaml, csv, tsv]")
+	rootCmd.Flags().StringVar(&flags.sortBy, "sort-by", "", "comma separated list of columns to sort by (default is namespace,pvc)")
+	rootCmd.Flags().BoolVar(&flags.reverse, "reverse", false, "reverse the sort order")
+	rootCmd.Flags().StringVar(&flags.groupBy, "group-by", "", "group volumes and print a subtotal per group; one of [namespace, node, storageclass, owner]")
+	rootCmd.Flags().BoolVar(&flags.perMount, "per-mount", false, "show one row per pod mounting a volume instead of one row per volume")
+	rootCmd.Flags().BoolVar(&flags.all, "all", false, "also list PVCs not mounted by any running pod (e.g. Pending claims or claims of workloads scaled to zero); their usage is unknown")
+	rootCmd.Flags().BoolVar(&flags.orphans, "orphans", false, "only list Released and Available PVs that have no claim")
+	rootCmd.Flags().BoolVar(&flags.summary, "summary", false, "only print the totals, per group with --group-by")
+	rootCmd.Flags().StringVar(&flags.severity, "severity", "", "comma separated list of severities to show; any of [red, yellow, green]")
+	rootCmd.Flags().Float64Var(&flags.minUsed, "min-used", 0, "only show volumes whose %used or %iused is at least this percentage")
+	rootCmd.Flags().Float64Var(&flags.maxUsed, "max-used", 100, "only show volumes whose %used or %iused is at most this percentage")
+	rootCmd.Flags().Float64Var(&flags.warnThreshold, "warn-threshold", DefaultThresholds.Bytes.Warn, "%used at or above which a volume is colored yellow")
+	rootCmd.Flags().Float64Var(&flags.criticalThreshold, "critical-threshold", DefaultThresholds.Bytes.Critical, "%used above which a volume is colored red")
+	rootCmd.Flags().Float64Var(&flags.inodeWarnThreshold, "inode-warn-threshold", DefaultThresholds.Inodes.Warn, "%iused at or above which inode columns are colored yellow")
+	rootCmd.Flags().Float64Var(&flags.inodeCriticalThreshold, "inode-critical-threshold", DefaultThresholds.Inodes.Critical, "%iused above which inode columns are colored red")
+	rootCmd.Flags().BoolVarP(&flags.watch, "watch", "w", false, "keep refreshing the output every --interval, adding delta and rate columns")
+	rootCmd.Flags().DurationVar(&flags.interval, "interval", 5*time.Second, "refresh interval for --watch")
+	rootCmd.Flags().BoolVar(&flags.noHeaders, "no-headers", false, "when using csv or tsv output, don't print headers")
+
+	addCollectionFlags(rootCmd.Flags(), flags)
+	addAnnotationFlags(rootCmd.Flags(), flags)
+	addSourceFlags(rootCmd.Flags(), flags)
+	addProbeFlags(rootCmd.Flags(), flags)
+
+	rootCmd.AddCommand(setupServeCommand(flags))
+	rootCmd.AddCommand(setupCheckCommand(flags))
+	rootCmd.AddCommand(setupDumpCommand(flags))
 
 	return rootCmd
 }
 
-func runRootCommand(flags *flagpole) error {
+// addAnnotationFlags adds the flags of the commands that evaluate the df-pv.io/* annotations of the PVCs, i.e. df-pv
+// itself and check; serve exports the stats of every volume and leaves thresholds to the alerting rules, and dump
+// saves the PVCs as they are
+func addAnnotationFlags(flagSet *pflag.FlagSet, flags *flagpole) {
+	flagSet.BoolVar(&flags.ignoreAnnotations, "ignore-annotations", false, "ignore the df-pv.io/* threshold and ignore annotations on PVCs")
+}
+
+// addCollectionFlags adds the flags shared by every command that collects volume stats
+func addCollectionFlags(flagSet *pflag.FlagSet, flags *flagpole) {
+	flagSet.StringArrayVar(&flags.excludeNamespaces, "exclude-namespace", nil, "namespace to exclude; may be a glob (e.g. 'ci-*') or a regular expression enclosed in slashes (e.g. '/^ci-[0-9]+$/'); can be repeated")
+	flagSet.StringVar(&flags.namespaceSelector, "namespace-selector", "", "label selector to choose namespaces by (e.g. 'team=storage')")
+	flagSet.IntVar(&flags.maxConcurrency, "max-concurrency", 20, "maximum number of nodes to query at the same time; 0 means unlimited")
+	flagSet.DurationVar(&flags.nodeTimeout, "node-timeout", 30*time.Second, "timeout for each stats request sent to a node; 0 means no timeout")
+	flagSet.IntVar(&flags.nodeRetries, "node-retries", 2, "number of times a node stats request failing with a transient error (5xx or 429) is retried with exponential backoff")
+	flagSet.BoolVar(&flags.kubeletDirect, "kubelet-direct", false, "query the kubelet of each node directly at its InternalIP, instead of through the API server's node proxy, with the credentials of the kubeconfig; same as --source kubelet")
+	flagSet.StringVar(&flags.kubeletCAFile, "kubelet-certificate-authority", "", "path to a CA bundle verifying the kubelet serving certificates with the kubelet source (default the CA of the kubeconfig)")
+	flagSet.BoolVar(&flags.kubeletInsecure, "kubelet-insecure-skip-tls-verify", false, "do not verify the kubelet serving certificates with the kubelet source")
+
+	if flags.genericCliConfigFlags == nil {
+		flags.genericCliConfigFlags = genericclioptions.NewConfigFlags(false)
+	}
+	flags.genericCliConfigFlags.AddFlags(flagSet)
+}
+
+// nodeQueryOptions builds the node query options from the --max-concurrency, --node-timeout, --node-retries and
+// --kubelet-* flags
+func (flags *flagpole) nodeQueryOptions() NodeQueryOptions {
+	return NodeQueryOptions{
+		MaxConcurrency: flags.maxConcurrency,
+		Timeout:        flags.nodeTimeout,
+		Retries:        flags.nodeRetries,
+		InitialBackoff: 500 * time.Millisecond,
+		Kubelet: KubeletOptions{
+			Direct:                flags.isKubeletDirect(),
+			CertificateAuthority:  flags.kubeletCAFile,
+			InsecureSkipTLSVerify: flags.kubeletInsecure,
+		},
+	}
+}
+
+// namespaceFilter builds the namespace filter from the -n, --exclude-namespace and --namespace-selector flags
+func (flags *flagpole) namespaceFilter() (*NamespaceFilter, error) {
+	if err := validateNamespaceSelector(flags.namespaceSelector); err != nil {
+		return nil, err
+	}
+	var namespaces string
+	if flags.genericCliConfigFlags != nil && flags.genericCliConfigFlags.Namespace != nil {
+		namespaces = *flags.genericCliConfigFlags.Namespace
+	}
+	return NewNamespaceFilter(namespaces, flags.excludeNamespaces)
+}
+
+// rootCommandOptions holds the validated flags of the root command
+type rootCommandOptions struct {
+	columns         string
+	outputFormat    string
+	sortBy          []string
+	thresholds      Thresholds
+	rowFilter       *RowFilter
+	namespaceFilter *NamespaceFilter
+	groupBy         string
+	summary         bool
+}
+
+// parse validates the flags before any kubernetes access
+func (flags *flagpole) parse() (*rootCommandOptions, error) {
 	if _, err := parseColumns(flags.columns); err != nil {
-		return errors.Wrap(err, "invalid columns")
+		return nil, errors.Wrap(err, "invalid columns")
+	}
+	outputFormat, err := parseOutputFormat(flags.output)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid output format")
+	}
+	sortBy, err := parseSortBy(flags.sortBy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sort-by")
+	}
+	thresholds, err := NewThresholds(flags.warnThreshold, flags.criticalThreshold, flags.inodeWarnThreshold, flags.inodeCriticalThreshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid thresholds")
+	}
+	rowFilter, err := NewRowFilter(flags.severity, flags.minUsed, flags.maxUsed, thresholds)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+	namespaceFilter, err := flags.namespaceFilter()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid namespace selection")
+	}
+	groupBy, err := parseGroupBy(flags.groupBy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid group-by")
+	}
+	if flags.summary && isDelimitedOutputFormat(outputFormat) {
+		return nil, fmt.Errorf("summary is not supported with %s output", outputFormat)
+	}
+	if flags.all && flags.orphans {
+		return nil, fmt.Errorf("all and orphans cannot be combined")
+	}
+	if err := flags.validateSource(); err != nil {
+		return nil, err
+	}
+	if err := flags.nodeQueryOptions().validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid node query options")
+	}
+	if _, err := GetRequestTimeoutFromGenericCliConfigFlags(flags.genericCliConfigFlags); err != nil {
+		return nil, err
+	}
+	if flags.watch && flags.interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", flags.interval)
+	}
+	columns := flags.columns
+	if columns == "" && (flags.watch || flags.all || flags.orphans) {
+		selectedColumns := append([]string(nil), defaultColumnOrder...)
+		if flags.orphans {
+			selectedColumns = append([]string(nil), orphanColumnOrder...)
+		} else if flags.all {
+			selectedColumns = append(selectedColumns, "status")
+		}
+		if flags.watch {
+			selectedColumns = append(selectedColumns, watchColumnOrder...)
+		}
+		columns = strings.Join(selectedColumns, ",")
+	}
+	return &rootCommandOptions{
+		columns:         columns,
+		outputFormat:    outputFormat,
+		sortBy:          sortBy,
+		thresholds:      thresholds,
+		rowFilter:       rowFilter,
+		namespaceFilter: namespaceFilter,
+		groupBy:         groupBy,
+		summary:         flags.summary,
+	}, nil
+}
+
+// needsOwners reports whether the owning workloads have to be resolved, which costs a few extra list calls
+func (flags *flagpole) needsOwners() bool {
+	if strings.TrimSpace(strings.ToLower(flags.groupBy)) == groupByOwner {
+		return true
+	}
+	columns, _ := parseColumnNames(flags.columns)
+	sortBy, _ := parseSortBy(flags.sortBy)
+	for _, column := range append(columns, sortBy...) {
+		if column == "owner" || column == "owner-kind" {
+			return true
+		}
+	}
+	return false
+}
+
+func runRootCommand(flags *flagpole) error {
+	opts, err := flags.parse()
+	if err != nil {
+		return err
 	}
 
 	logLevel, _ := log.ParseLevel(flags.logLevel)
@@ -107,37 +348,333 @@ func runRootCommand(flags *flagpole) error {
 		FullTimestamp: true,
 	})
 
-	sliceOfOutputRowPVC, err := GetSliceOfOutputRowPVC(flags)
+	if flags.probeDryRun {
+		return runProbeDryRun(context.Background(), flags, os.Stdout)
+	}
+	if flags.watch {
+		return runWatch(flags, opts)
+	}
+
+	collectedAt := time.Now()
+	sliceOfOutputRowPVC, nodeCollectionErr, err := collectOutputRows(context.Background(), flags, opts)
+	if reportErr := reportNodeErrors(nodeCollectionErr); reportErr != nil {
+		return reportErr
+	}
 	if err != nil {
-		return errors.Wrapf(err, "error getting output slice")
+		return err
 	}
+	if err := printOutputRows(flags, opts, sliceOfOutputRowPVC, nodeCollectionErr, collectedAt); err != nil {
+		return err
+	}
+	return partialResultsError(nodeCollectionErr)
+}
 
-	if nil == sliceOfOutputRowPVC || 0 > len(sliceOfOutputRowPVC) {
-		// ns := flags.namespace
-		ns := *flags.genericCliConfigFlags.Namespace
-		if 0 == len(ns) {
-			ns = "all"
+// collectOutputRows collects, filters and sorts the output rows; failed nodes are returned as a *NodeCollectionError,
+// also along with the error when every node failed, for the caller to report them with reportNodeErrors
+func collectOutputRows(ctx context.Context, flags *flagpole, opts *rootCommandOptions) ([]*OutputRowPVC, *NodeCollectionError, error) {
+	sliceOfOutputRowPVC, err := GetSliceOfOutputRowPVC(ctx, flags)
+	var nodeCollectionErr *NodeCollectionError
+	if errors.As(err, &nodeCollectionErr) {
+		if !nodeCollectionErr.IsPartial() {
+			return nil, nodeCollectionErr, &ExitCodeError{Code: exitCodeError, Err: errors.Wrapf(err, "error getting output slice")}
 		}
-		log.Infof("Either no volumes found in namespace/s: '%s' or the storage provisioner used for the volumes does not publish metrics to kubelet", ns)
-	} else {
-		if err := PrintUsingGoPretty(sliceOfOutputRowPVC, flags.disableColor, flags.columns); err != nil {
-			return errors.Wrap(err, "error printing output")
+	} else if err != nil {
+		return nil, nil, errors.Wrapf(err, "error getting output slice")
+	}
+	if !flags.perMount {
+		sliceOfOutputRowPVC = DeduplicateOutputRows(sliceOfOutputRowPVC)
+	}
+	sliceOfOutputRowPVC = FilterOutputRows(sliceOfOutputRowPVC, opts.rowFilter)
+	SortOutputRows(sliceOfOutputRowPVC, opts.sortBy, flags.reverse)
+	if opts.groupBy != "" {
+		SortOutputRowsByGroup(sliceOfOutputRowPVC, opts.groupBy)
+	}
+	return sliceOfOutputRowPVC, nodeCollectionErr, nil
+}
+
+// reportNodeErrors lists the failed nodes, if any, on stderr
+func reportNodeErrors(nodeCollectionErr *NodeCollectionError) error {
+	if nodeCollectionErr == nil {
+		return nil
+	}
+	return errors.Wrap(PrintNodeErrors(os.Stderr, nodeCollectionErr), "error printing failed nodes")
+}
+
+// printOutputRows prints the output rows in the requested output format
+func printOutputRows(flags *flagpole, opts *rootCommandOptions, sliceOfOutputRowPVC []*OutputRowPVC, nodeCollectionErr *NodeCollectionError, collectedAt time.Time) error {
+	if isStructuredOutputFormat(opts.outputFormat) {
+		var contextName string
+		if !flags.isOffline() {
+			contextName = GetContextNameFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+		}
+		list := NewVolumeUsageList(sliceOfOutputRowPVC, contextName, collectedAt)
+		if nodeCollectionErr != nil {
+			list.Metadata.FailedNodes = nodeCollectionErr.FailedNodes
+		}
+		if opts.groupBy != "" || opts.summary {
+			var groups []*OutputRowGroup
+			if opts.groupBy != "" {
+				groups = GroupOutputRows(sliceOfOutputRowPVC, opts.groupBy)
+			}
+			list.SetGroups(groups, opts.groupBy, opts.summary)
 		}
+		return errors.Wrap(PrintStructured(os.Stdout, list, opts.outputFormat), "error printing output")
 	}
 
-	return nil
+	if isDelimitedOutputFormat(opts.outputFormat) {
+		return errors.Wrap(PrintDelimited(os.Stdout, sliceOfOutputRowPVC, opts.columns, delimiterForOutputFormat(opts.outputFormat), flags.noHeaders), "error printing output")
+	}
+
+	if nil == sliceOfOutputRowPVC || 0 > len(sliceOfOutputRowPVC) {
+		log.Infof("Either no volumes found in namespace/s: '%s' or the storage provisioner used for the volumes does not publish metrics to kubelet", opts.namespaceFilter)
+		return nil
+	}
+	if opts.summary {
+		var groups []*OutputRowGroup
+		if opts.groupBy != "" {
+			groups = GroupOutputRows(sliceOfOutputRowPVC, opts.groupBy)
+		}
+		return errors.Wrap(PrintSummaryUsingGoPretty(groups, opts.groupBy, SumOutputRows(sliceOfOutputRowPVC), len(uniqueVolumes(sliceOfOutputRowPVC)), flags.disableColor, opts.columns, opts.thresholds), "error printing output")
+	}
+	if opts.groupBy != "" {
+		return errors.Wrap(PrintGroupsUsingGoPretty(GroupOutputRows(sliceOfOutputRowPVC, opts.groupBy), flags.disableColor, opts.columns, opts.thresholds), "error printing output")
+	}
+	return errors.Wrap(PrintUsingGoPretty(sliceOfOutputRowPVC, flags.disableColor, opts.columns, opts.thresholds), "error printing output")
+}
+
+// partialResultsError turns failed nodes into an error carrying the partial results exit code
+func partialResultsError(nodeCollectionErr *NodeCollectionError) error {
+	if nodeCollectionErr == nil {
+		return nil
+	}
+	return &ExitCodeError{Code: exitCodePartialResults, Err: nodeCollectionErr}
 }
 
 type columnDef struct {
-	header string
-	value  func(row *OutputRowPVC) interface{}
-	color  func(row *OutputRowPVC) text.Color
-	format string
+	header  string
+	value   func(row *OutputRowPVC) interface{}
+	raw     func(row *OutputRowPVC) string
+	numeric func(row *OutputRowPVC) float64
+	color   func(row *OutputRowPVC, thresholds Thresholds) text.Color
+	format  string
+	// usage columns are shown as unknown for volumes whose usage could not be queried
+	usage bool
+}
+
+var allColumns = map[string]columnDef{
+	"pv": {
+		header: "PV Name",
+		value:  func(row *OutputRowPVC) interface{} { return row.PVName },
+		format: "%s",
+	},
+	"pvc": {
+		header: "PVC Name",
+		value:  func(row *OutputRowPVC) interface{} { return row.PVCName },
+		format: "%s",
+	},
+	"namespace": {
+		header: "Namespace",
+		value:  func(row *OutputRowPVC) interface{} { return row.Namespace },
+		format: "%s",
+	},
+	"node": {
+		header: "Node Name",
+		value:  func(row *OutputRowPVC) interface{} { return row.NodeName },
+		format: "%s",
+	},
+	"pod": {
+		header: "Pod Name",
+		value:  func(row *OutputRowPVC) interface{} { return row.PodName },
+		format: "%s",
+	},
+	"mount": {
+		header: "Volume Mount Name",
+		value:  func(row *OutputRowPVC) interface{} { return row.VolumeMountName },
+		format: "%s",
+	},
+	"size": {
+		header: "Size",
+		// unknown for an unmounted PVC requesting no storage, e.g. of a static PV
+		value: func(row *OutputRowPVC) interface{} {
+			if row.CapacityBytes == nil {
+				return ""
+			}
+			return ConvertQuantityValueToHumanReadableIECString(row.CapacityBytes)
+		},
+		raw: func(row *OutputRowPVC) string {
+			if row.CapacityBytes == nil {
+				return ""
+			}
+			return strconv.FormatInt(quantityValue(row.CapacityBytes), 10)
+		},
+		numeric: func(row *OutputRowPVC) float64 { return float64(quantityValue(row.CapacityBytes)) },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Bytes.Color(row.PercentageUsed)
+		},
+		format: "%s",
+	},
+	"used": {
+		header: "Used",
+		value: func(row *OutputRowPVC) interface{} {
+			return ConvertQuantityValueToHumanReadableIECString(row.UsedBytes)
+		},
+		raw:     func(row *OutputRowPVC) string { return strconv.FormatInt(quantityValue(row.UsedBytes), 10) },
+		numeric: func(row *OutputRowPVC) float64 { return float64(quantityValue(row.UsedBytes)) },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Bytes.Color(row.PercentageUsed)
+		},
+		format: "%s",
+		usage:  true,
+	},
+	"available": {
+		header: "Available",
+		value: func(row *OutputRowPVC) interface{} {
+			return ConvertQuantityValueToHumanReadableIECString(row.AvailableBytes)
+		},
+		raw:     func(row *OutputRowPVC) string { return strconv.FormatInt(quantityValue(row.AvailableBytes), 10) },
+		numeric: func(row *OutputRowPVC) float64 { return float64(quantityValue(row.AvailableBytes)) },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Bytes.Color(row.PercentageUsed)
+		},
+		format: "%s",
+		usage:  true,
+	},
+	"%used": {
+		header:  "%Used",
+		value:   func(row *OutputRowPVC) interface{} { return row.PercentageUsed },
+		raw:     func(row *OutputRowPVC) string { return rawPercentage(row.PercentageUsed) },
+		numeric: func(row *OutputRowPVC) float64 { return row.PercentageUsed },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Bytes.Color(row.PercentageUsed)
+		},
+		format: "%.2f",
+		usage:  true,
+	},
+	"iused": {
+		header:  "iused",
+		value:   func(row *OutputRowPVC) interface{} { return row.InodesUsed },
+		numeric: func(row *OutputRowPVC) float64 { return float64(row.InodesUsed) },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Inodes.Color(row.PercentageIUsed)
+		},
+		format: "%d",
+		usage:  true,
+	},
+	"ifree": {
+		header:  "ifree",
+		value:   func(row *OutputRowPVC) interface{} { return row.InodesFree },
+		numeric: func(row *OutputRowPVC) float64 { return float64(row.InodesFree) },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Inodes.Color(row.PercentageIUsed)
+		},
+		format: "%d",
+		usage:  true,
+	},
+	"%iused": {
+		header:  "%iused",
+		value:   func(row *OutputRowPVC) interface{} { return row.PercentageIUsed },
+		raw:     func(row *OutputRowPVC) string { return rawPercentage(row.PercentageIUsed) },
+		numeric: func(row *OutputRowPVC) float64 { return row.PercentageIUsed },
+		color: func(row *OutputRowPVC, thresholds Thresholds) text.Color {
+			return thresholds.Inodes.Color(row.PercentageIUsed)
+		},
+		format: "%.2f",
+		usage:  true,
+	},
+	"delta": {
+		header: "Delta",
+		value:  func(row *OutputRowPVC) interface{} { return FormatUsedBytesDelta(row.UsedBytesDelta) },
+		raw: func(row *OutputRowPVC) string {
+			if row.UsedBytesDelta == nil {
+				return ""
+			}
+			return strconv.FormatInt(*row.UsedBytesDelta, 10)
+		},
+		numeric: func(row *OutputRowPVC) float64 {
+			if row.UsedBytesDelta == nil {
+				return 0
+			}
+			return float64(*row.UsedBytesDelta)
+		},
+		format: "%s",
+	},
+	"rate": {
+		header: "Rate",
+		value:  func(row *OutputRowPVC) interface{} { return FormatUsedBytesPerSecond(row.UsedBytesPerSecond) },
+		raw: func(row *OutputRowPVC) string {
+			if row.UsedBytesPerSecond == nil {
+				return ""
+			}
+			return strconv.FormatFloat(*row.UsedBytesPerSecond, 'f', 2, 64)
+		},
+		numeric: func(row *OutputRowPVC) float64 {
+			if row.UsedBytesPerSecond == nil {
+				return 0
+			}
+			return *row.UsedBytesPerSecond
+		},
+		format: "%s",
+	},
+	"storageclass":  stringColumn("Storage Class", func(row *OutputRowPVC) string { return row.StorageClass }),
+	"accessmodes":   stringColumn("Access Modes", func(row *OutputRowPVC) string { return FormatAccessModes(row.AccessModes) }),
+	"volumemode":    stringColumn("Volume Mode", func(row *OutputRowPVC) string { return row.VolumeMode }),
+	"reclaimpolicy": stringColumn("Reclaim Policy", func(row *OutputRowPVC) string { return row.ReclaimPolicy }),
+	"csidriver":     stringColumn("CSI Driver", func(row *OutputRowPVC) string { return row.CSIDriver }),
+	"volumehandle":  stringColumn("Volume Handle", func(row *OutputRowPVC) string { return row.VolumeHandle }),
+	"owner-kind":    stringColumn("Owner Kind", func(row *OutputRowPVC) string { return row.OwnerKind }),
+	"owner":         stringColumn("Owner", func(row *OutputRowPVC) string { return row.OwnerName }),
+	"consumers":     stringColumn("Consumers", FormatConsumers),
+	"status":        stringColumn("Status", func(row *OutputRowPVC) string { return row.Phase }),
+	"source":        stringColumn("Source", func(row *OutputRowPVC) string { return row.Source }),
+	"requested": {
+		header: "Requested",
+		value: func(row *OutputRowPVC) interface{} {
+			if row.RequestedBytes == nil {
+				return ""
+			}
+			return ConvertQuantityValueToHumanReadableIECString(row.RequestedBytes)
+		},
+		raw: func(row *OutputRowPVC) string {
+			if row.RequestedBytes == nil {
+				return ""
+			}
+			return strconv.FormatInt(quantityValue(row.RequestedBytes), 10)
+		},
+		numeric: func(row *OutputRowPVC) float64 { return float64(quantityValue(row.RequestedBytes)) },
+		format:  "%s",
+	},
+	"age": {
+		header: "Age",
+		value:  func(row *OutputRowPVC) interface{} { return FormatAge(row.CreationTimestamp, time.Now()) },
+		raw: func(row *OutputRowPVC) string {
+			if row.CreationTimestamp == nil {
+				return ""
+			}
+			return strconv.FormatInt(int64(time.Since(row.CreationTimestamp.Time).Seconds()), 10)
+		},
+		numeric: func(row *OutputRowPVC) float64 {
+			if row.CreationTimestamp == nil {
+				return 0
+			}
+			return time.Since(row.CreationTimestamp.Time).Seconds()
+		},
+		format: "%s",
+	},
+}
+
+// stringColumn defines a plain text column
+func stringColumn(header string, value func(row *OutputRowPVC) string) columnDef {
+	return columnDef{
+		header: header,
+		value:  func(row *OutputRowPVC) interface{} { return value(row) },
+		format: "%s",
+	}
 }
 
 var defaultColumnOrder = []string{"pv", "pvc", "namespace", "node", "pod", "mount", "size", "used", "available", "%used"}
 
-var availableColumnOrder = []string{"pv", "pvc", "namespace", "node", "pod", "mount", "size", "used", "available", "%used", "iused", "ifree", "%iused"}
+var availableColumnOrder = []string{"pv", "pvc", "namespace", "node", "pod", "mount", "size", "used", "available", "%used", "iused", "ifree", "%iused", "delta", "rate",
+	"storageclass", "accessmodes", "volumemode", "reclaimpolicy", "csidriver", "volumehandle", "requested", "age", "owner-kind", "owner", "consumers", "status", "source"}
 
 var validColumnNames = map[string]struct{}{
 	"pv":        {},
@@ -153,13 +690,33 @@ var validColumnNames = map[string]struct{}{
 	"iused":     {},
 	"ifree":     {},
 	"%iused":    {},
+	"delta":     {},
+	"rate":      {},
+
+	"storageclass":  {},
+	"accessmodes":   {},
+	"volumemode":    {},
+	"reclaimpolicy": {},
+	"csidriver":     {},
+	"volumehandle":  {},
+	"requested":     {},
+	"age":           {},
+	"owner-kind":    {},
+	"owner":         {},
+	"consumers":     {},
+	"status":        {},
+	"source":        {},
 }
 
 func parseColumns(columns string) ([]string, error) {
 	if columns == "" {
 		return append([]string(nil), defaultColumnOrder...), nil
 	}
+	return parseColumnNames(columns)
+}
 
+// parseColumnNames normalizes and validates a comma separated list of column names
+func parseColumnNames(columns string) ([]string, error) {
 	selectedColumns := strings.Split(columns, ",")
 	for i, colName := range selectedColumns {
 		normalizedName := strings.TrimSpace(strings.ToLower(colName))
@@ -175,100 +732,91 @@ func parseColumns(columns string) ([]string, error) {
 	return selectedColumns, nil
 }
 
-// PrintUsingGoPretty prints a slice of output rows
-func PrintUsingGoPretty(sliceOfOutputRowPVC []*OutputRowPVC, disableColor bool, columns string) error {
+// PrintUsingGoPretty prints a slice of output rows, coloring usage based on the given thresholds
+func PrintUsingGoPretty(sliceOfOutputRowPVC []*OutputRowPVC, disableColor bool, columns string, thresholds Thresholds) error {
 	selectedColumns, err := parseColumns(columns)
 	if err != nil {
 		return err
 	}
 
-	if disableColor {
-		text.DisableColors()
+	t := newGoPrettyTable(goPrettyHeader(selectedColumns), disableColor)
+	for _, pvcRow := range sliceOfOutputRowPVC {
+		t.AppendRow(goPrettyRow(pvcRow, selectedColumns, thresholds))
 	}
-	// https://github.com/jedib0t/go-pretty/tree/v6.0.4/table
-	t := table.NewWriter()
+	fmt.Printf("\n%s\n\n", t.Render())
+	return nil
+}
 
-	allColumns := map[string]columnDef{
-		"pv": {
-			header: "PV Name",
-			value:  func(row *OutputRowPVC) interface{} { return row.PVName },
-			format: "%s",
-		},
-		"pvc": {
-			header: "PVC Name",
-			value:  func(row *OutputRowPVC) interface{} { return row.PVCName },
-			format: "%s",
-		},
-		"namespace": {
-			header: "Namespace",
-			value:  func(row *OutputRowPVC) interface{} { return row.Namespace },
-			format: "%s",
-		},
-		"node": {
-			header: "Node Name",
-			value:  func(row *OutputRowPVC) interface{} { return row.NodeName },
-			format: "%s",
-		},
-		"pod": {
-			header: "Pod Name",
-			value:  func(row *OutputRowPVC) interface{} { return row.PodName },
-			format: "%s",
-		},
-		"mount": {
-			header: "Volume Mount Name",
-			value:  func(row *OutputRowPVC) interface{} { return row.VolumeMountName },
-			format: "%s",
-		},
-		"size": {
-			header: "Size",
-			value: func(row *OutputRowPVC) interface{} {
-				return ConvertQuantityValueToHumanReadableIECString(row.CapacityBytes)
-			},
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageUsed) },
-			format: "%s",
-		},
-		"used": {
-			header: "Used",
-			value: func(row *OutputRowPVC) interface{} {
-				return ConvertQuantityValueToHumanReadableIECString(row.UsedBytes)
-			},
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageUsed) },
-			format: "%s",
-		},
-		"available": {
-			header: "Available",
-			value: func(row *OutputRowPVC) interface{} {
-				return ConvertQuantityValueToHumanReadableIECString(row.AvailableBytes)
-			},
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageUsed) },
-			format: "%s",
-		},
-		"%used": {
-			header: "%Used",
-			value:  func(row *OutputRowPVC) interface{} { return row.PercentageUsed },
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageUsed) },
-			format: "%.2f",
-		},
-		"iused": {
-			header: "iused",
-			value:  func(row *OutputRowPVC) interface{} { return row.InodesUsed },
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageIUsed) },
-			format: "%d",
-		},
-		"ifree": {
-			header: "ifree",
-			value:  func(row *OutputRowPVC) interface{} { return row.InodesFree },
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageIUsed) },
-			format: "%d",
-		},
-		"%iused": {
-			header: "%iused",
-			value:  func(row *OutputRowPVC) interface{} { return row.PercentageIUsed },
-			color:  func(row *OutputRowPVC) text.Color { return GetColorFromPercentageUsed(row.PercentageIUsed) },
-			format: "%.2f",
-		},
+// PrintGroupsUsingGoPretty prints the rows of each group followed by the group's subtotal, and the grand total
+// as footer
+func PrintGroupsUsingGoPretty(groups []*OutputRowGroup, disableColor bool, columns string, thresholds Thresholds) error {
+	selectedColumns, err := parseColumns(columns)
+	if err != nil {
+		return err
+	}
+
+	t := newGoPrettyTable(goPrettyHeader(selectedColumns), disableColor)
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	for i, group := range groups {
+		if 0 < i {
+			t.AppendRow(table.Row{""})
+		}
+		for _, pvcRow := range group.Rows {
+			t.AppendRow(goPrettyRow(pvcRow, selectedColumns, thresholds))
+		}
+		t.AppendRow(goPrettySubtotalRow(group.Subtotal, fmt.Sprintf("Subtotal (%d)", group.Volumes), selectedColumns, thresholds))
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, group.Rows...)
+	}
+	t.AppendFooter(goPrettySubtotalRow(SumOutputRows(sliceOfOutputRowPVC), fmt.Sprintf("Total (%d)", len(uniqueVolumes(sliceOfOutputRowPVC))), selectedColumns, thresholds))
+	fmt.Printf("\n%s\n\n", t.Render())
+	return nil
+}
+
+// PrintSummaryUsingGoPretty prints one row per group, if any, and the grand total, limited to the selected
+// columns that can be added up
+func PrintSummaryUsingGoPretty(groups []*OutputRowGroup, groupBy string, total *OutputRowPVC, volumes int, disableColor bool, columns string, thresholds Thresholds) error {
+	selectedColumns, err := parseColumns(columns)
+	if err != nil {
+		return err
+	}
+	var summaryColumns []string
+	for _, colName := range selectedColumns {
+		for _, summaryColumn := range summaryColumnOrder {
+			if colName == summaryColumn {
+				summaryColumns = append(summaryColumns, colName)
+			}
+		}
+	}
+	if 0 == len(summaryColumns) {
+		summaryColumns = []string{"size", "used", "available", "%used"}
 	}
 
+	header := table.Row{"Volumes"}
+	if groupBy != "" {
+		header = table.Row{groupHeaders[groupBy], "Volumes"}
+	}
+	t := newGoPrettyTable(append(header, goPrettyHeader(summaryColumns)...), disableColor)
+
+	for _, group := range groups {
+		row := table.Row{group.Key, group.Volumes}
+		t.AppendRow(append(row, goPrettyRow(group.Subtotal, summaryColumns, thresholds)...))
+	}
+	footer := table.Row{volumes}
+	if groupBy != "" {
+		footer = table.Row{"Total", volumes}
+	}
+	footer = append(footer, goPrettyRow(total, summaryColumns, thresholds)...)
+	if groupBy != "" {
+		t.AppendFooter(footer)
+	} else {
+		t.AppendRow(footer)
+	}
+	fmt.Printf("\n%s\n\n", t.Render())
+	return nil
+}
+
+// goPrettyHeader returns the headers of the selected columns
+func goPrettyHeader(selectedColumns []string) table.Row {
 	var headerRow table.Row
 	for _, colName := range selectedColumns {
 		colName = strings.TrimSpace(strings.ToLower(colName))
@@ -276,46 +824,123 @@ func PrintUsingGoPretty(sliceOfOutputRowPVC []*OutputRowPVC, disableColor bool,
 			headerRow = append(headerRow, def.header)
 		}
 	}
-	t.AppendHeader(headerRow)
+	return headerRow
+}
 
-	for _, pvcRow := range sliceOfOutputRowPVC {
-		var row []interface{}
-		for _, colName := range selectedColumns {
-			colName = strings.TrimSpace(strings.ToLower(colName))
-			if def, ok := allColumns[colName]; ok {
-				val := def.value(pvcRow)
-				if def.color != nil {
-					c := def.color(pvcRow)
-					row = append(row, c.Sprintf(def.format, val))
-				} else {
-					row = append(row, fmt.Sprintf(def.format, val))
-				}
-			}
-		}
-		t.AppendRow(row)
+// newGoPrettyTable creates a table with the given header
+func newGoPrettyTable(headerRow table.Row, disableColor bool) table.Writer {
+	if disableColor {
+		text.DisableColors()
 	}
+	// https://github.com/jedib0t/go-pretty/tree/v6.0.4/table
+	t := table.NewWriter()
+	t.AppendHeader(headerRow)
 
 	// https://github.com/jedib0t/go-pretty/blob/v6.0.4/table/style.go
 	styleBold := table.StyleBold
 	styleBold.Options = table.OptionsNoBordersAndSeparators
 	t.SetStyle(styleBold)
 	t.Style().Color.Header = text.Colors{text.FgWhite, text.Bold}
+	t.Style().Color.Footer = text.Colors{text.Bold}
+	t.Style().Format.Footer = text.FormatDefault
 	// t.Style().Options.SeparateRows = true
 	// t.SetAutoIndex(true)
 	// t.SetOutputMirror(os.Stdout)
-	fmt.Printf("\n%s\n\n", t.Render())
-	return nil
+	return t
 }
 
-// GetColorFromPercentageUsed gives a color based on percentage
-func GetColorFromPercentageUsed(percentageUsed float64) text.Color {
-	if percentageUsed > 75 {
-		return text.FgRed
-	} else if percentageUsed < 25 {
-		return text.FgGreen
-	} else {
-		return text.FgYellow
+// goPrettyRow formats the selected columns of a row, colored by the thresholds that apply to it
+func goPrettyRow(pvcRow *OutputRowPVC, selectedColumns []string, thresholds Thresholds) table.Row {
+	var row table.Row
+	rowThresholds := pvcRow.EffectiveThresholds(thresholds)
+	for _, colName := range selectedColumns {
+		colName = strings.TrimSpace(strings.ToLower(colName))
+		if def, ok := allColumns[colName]; ok {
+			if def.usage && pvcRow.UsageUnknown {
+				row = append(row, unknownUsage)
+				continue
+			}
+			val := def.value(pvcRow)
+			if c := columnColor(def, pvcRow, rowThresholds); c != text.Reset {
+				row = append(row, c.Sprintf(def.format, val))
+			} else {
+				row = append(row, fmt.Sprintf(def.format, val))
+			}
+		}
+	}
+	return row
+}
+
+// columnColor returns the color of a column of a row, or text.Reset when it is not colored: ignored volumes have no
+// severity and unknown usage no color
+func columnColor(def columnDef, pvcRow *OutputRowPVC, thresholds Thresholds) text.Color {
+	if def.color == nil || pvcRow.Ignored {
+		return text.Reset
+	}
+	return def.color(pvcRow, thresholds)
+}
+
+// goPrettySubtotalRow formats a subtotal row, with the label in the first text column left empty
+func goPrettySubtotalRow(subtotal *OutputRowPVC, label string, selectedColumns []string, thresholds Thresholds) table.Row {
+	row := goPrettyRow(subtotal, selectedColumns, thresholds)
+	for i, colName := range selectedColumns {
+		def := allColumns[strings.TrimSpace(strings.ToLower(colName))]
+		if def.numeric == nil && row[i] == "" {
+			row[i] = text.Bold.Sprint(label)
+			break
+		}
+	}
+	return row
+}
+
+// PrintDelimited prints a slice of output rows as delimiter separated values (e.g. csv or tsv) with raw byte counts
+func PrintDelimited(w io.Writer, sliceOfOutputRowPVC []*OutputRowPVC, columns string, delimiter rune, noHeaders bool) error {
+	selectedColumns, err := parseColumns(columns)
+	if err != nil {
+		return err
+	}
+
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = delimiter
+
+	if !noHeaders {
+		if err := csvWriter.Write(selectedColumns); err != nil {
+			return errors.Wrap(err, "unable to write header")
+		}
+	}
+
+	for _, pvcRow := range sliceOfOutputRowPVC {
+		var record []string
+		for _, colName := range selectedColumns {
+			def := allColumns[colName]
+			if def.usage && pvcRow.UsageUnknown {
+				record = append(record, "")
+			} else if def.raw != nil {
+				record = append(record, def.raw(pvcRow))
+			} else {
+				record = append(record, fmt.Sprintf(def.format, def.value(pvcRow)))
+			}
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return errors.Wrap(err, "unable to write row")
+		}
 	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// rawPercentage formats a percentage for delimited output, leaving it empty when it cannot be computed
+func rawPercentage(percentage float64) string {
+	if finitePercentage(percentage) == nil {
+		return ""
+	}
+	return strconv.FormatFloat(percentage, 'f', 2, 64)
+}
+
+// GetColorFromPercentageUsed gives a color based on percentage using the default thresholds
+func GetColorFromPercentageUsed(percentageUsed float64) text.Color {
+	return DefaultThresholds.Bytes.Color(percentageUsed)
 }
 
 // ConvertQuantityValueToHumanReadableIECString converts value to human readable IEC format
@@ -351,6 +976,14 @@ func ConvertQuantityValueToHumanReadableIECString(quantity *resource.Quantity) s
 	return fmt.Sprintf("%s%s", strVal, suffix)
 }
 
+// quantityValue returns the int64 value of a quantity, treating nil as zero
+func quantityValue(quantity *resource.Quantity) int64 {
+	if quantity == nil {
+		return 0
+	}
+	return quantity.Value()
+}
+
 // ConvertQuantityValueToHumanReadableDecimalString converts value to human readable decimal format
 func ConvertQuantityValueToHumanReadableDecimalString(quantity *resource.Quantity) string {
 	val := quantity.Value()
@@ -375,24 +1008,54 @@ func ConvertQuantityValueToHumanReadableDecimalString(quantity *resource.Quantit
 
 // OutputRowPVC represents the output row
 type OutputRowPVC struct {
-	PVName          string             `json:"pvName"`
-	PVCName         string             `json:"pvcName"`
-	Namespace       string             `json:"namespace"`
-	NodeName        string             `json:"nodeName"`
-	PodName         string             `json:"podName"`
-	VolumeMountName string             `json:"volumeMountName"`
-	AvailableBytes  *resource.Quantity `json:"availableBytes"` // TODO: use uint64 here as well? but resource.Quantity takes int64
-	CapacityBytes   *resource.Quantity `json:"capacityBytes"`
-	UsedBytes       *resource.Quantity `json:"usedBytes"`
-	InodesFree      uint64             `json:"inodesFree"`
-	Inodes          uint64             `json:"inodes"`
-	InodesUsed      uint64             `json:"inodesUsed"`
-	PercentageUsed  float64            `json:"percentageUsed"`
-	PercentageIUsed float64            `json:"percentageIUsed"`
+	PVName          string `json:"pvName"`
+	PVCName         string `json:"pvcName"`
+	Namespace       string `json:"namespace"`
+	NodeName        string `json:"nodeName"`
+	PodName         string `json:"podName"`
+	VolumeMountName string `json:"volumeMountName"`
+	StorageClass    string `json:"storageClass,omitempty"`
+	// AccessModes to CreationTimestamp are read from the PVC and its PV
+	AccessModes       []string           `json:"accessModes,omitempty"`
+	VolumeMode        string             `json:"volumeMode,omitempty"`
+	ReclaimPolicy     string             `json:"reclaimPolicy,omitempty"`
+	CSIDriver         string             `json:"csiDriver,omitempty"`
+	VolumeHandle      string             `json:"volumeHandle,omitempty"`
+	RequestedBytes    *resource.Quantity `json:"requestedBytes,omitempty"`
+	CreationTimestamp *metav1.Time       `json:"creationTimestamp,omitempty"`
+	// OwnerKind and OwnerName identify the workload owning the pod, only resolved when needed
+	OwnerKind string `json:"ownerKind,omitempty"`
+	OwnerName string `json:"owner,omitempty"`
+	// Phase is the phase of the PVC, or of the PV for orphaned volumes
+	Phase string `json:"phase,omitempty"`
+	// UsageUnknown is set for volumes not mounted by any running pod, whose usage cannot be queried
+	UsageUnknown bool `json:"usageUnknown,omitempty"`
+	// Source is set when the usage was not reported by the kubelet, e.g. exec when measured with df inside the pod
+	Source string `json:"source,omitempty"`
+	// Consumers lists every pod mounting the volume once rows are deduplicated
+	Consumers []VolumeConsumer `json:"consumers,omitempty"`
+	// ThresholdOverrides and Ignored are read from the PVC annotations
+	ThresholdOverrides *ThresholdOverrides `json:"thresholdOverrides,omitempty"`
+	Ignored            bool                `json:"ignored,omitempty"`
+	AvailableBytes     *resource.Quantity  `json:"availableBytes"` // TODO: use uint64 here as well? but resource.Quantity takes int64
+	CapacityBytes      *resource.Quantity  `json:"capacityBytes"`
+	UsedBytes          *resource.Quantity  `json:"usedBytes"`
+	InodesFree         uint64              `json:"inodesFree"`
+	Inodes             uint64              `json:"inodes"`
+	InodesUsed         uint64              `json:"inodesUsed"`
+	PercentageUsed     float64             `json:"percentageUsed"`
+	PercentageIUsed    float64             `json:"percentageIUsed"`
+	// UsedBytesDelta and UsedBytesPerSecond are only set in watch mode, from the previous snapshot
+	UsedBytesDelta     *int64   `json:"usedBytesDelta,omitempty"`
+	UsedBytesPerSecond *float64 `json:"usedBytesPerSecond,omitempty"`
 }
 
 // ServerResponseStruct represents the response at the node endpoint
 type ServerResponseStruct struct {
+	// Node is only needed to tell which node a replayed response came from
+	Node struct {
+		NodeName string `json:"nodeName"`
+	} `json:"node"`
 	Pods []*Pod `json:"pods"`
 }
 
@@ -478,82 +1141,170 @@ type Volume struct {
 }
 
 // GetSliceOfOutputRowPVC gets the output row
-func GetSliceOfOutputRowPVC(flags *flagpole) ([]*OutputRowPVC, error) {
-
-	ctx := context.Background()
+func GetSliceOfOutputRowPVC(ctx context.Context, flags *flagpole) ([]*OutputRowPVC, error) {
+	sliceOfOutputRowPVC, _, err := getOutputRowsAndQueriedNodes(ctx, flags)
+	return sliceOfOutputRowPVC, err
+}
 
-	kubeConfig, err := GetKubeConfigFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+// getOutputRowsAndQueriedNodes gets the output rows along with the names of the nodes that were queried for them
+func getOutputRowsAndQueriedNodes(ctx context.Context, flags *flagpole) ([]*OutputRowPVC, []string, error) {
+	ctx, cancel, err := flags.withRequestTimeout(ctx)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to build config from flags")
+		return nil, nil, err
 	}
+	defer cancel()
 
 	// kubeConfigPath, err := KubeConfigPath()
 	// if err != nil {
-	// 	return nil, err
+	// 	return nil, nil, err
 	// }
 	//
 	// log.Debugf("instantiating k8s client from config path: '%s'", kubeConfigPath)
 	// kubeConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	// // kubeConfig, err := rest.InClusterConfig()
 	// if err != nil {
-	// 	return nil, errors.Wrapf(err, "unable to build config from flags")
+	// 	return nil, nil, errors.Wrapf(err, "unable to build config from flags")
 	// }
 
-	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	collection, err := flags.newStatsCollection(ctx)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create clientset")
+		return nil, nil, err
 	}
 
-	desiredNamespace := *flags.genericCliConfigFlags.Namespace
-	// desiredNamespace := flags.namespace
-	var sliceOfNodeName []string
-	if 0 == len(desiredNamespace) {
-		nodes, err := ListNodes(ctx, clientset)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to list nodes")
-		}
-		nodeItems := nodes.Items
-		for _, node := range nodeItems {
-			sliceOfNodeName = append(sliceOfNodeName, node.Name)
-		}
-	} else {
-		nodeNameToPodNames, err := GetWhichNodesToQueryBasedOnNamespace(ctx, clientset, desiredNamespace)
-		if err != nil {
-			return nil, err
-		}
-		for nodeName := range nodeNameToPodNames {
-			sliceOfNodeName = append(sliceOfNodeName, nodeName)
-		}
+	// orphaned PVs are cluster scoped and have no claim, so every PVC is needed and no node is queried
+	if flags.orphans {
+		sliceOfOutputRowPVC, err := collection.allClaimsIndex().OrphanedOutputRows(ctx, collection.namespaceFilter)
+		return sliceOfOutputRowPVC, nil, err
+	}
+
+	sliceOfNodeName, err := collection.source.Nodes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := collection.loadClaims(ctx); err != nil {
+		return nil, nil, err
 	}
 
 	var mainGroup run.Group
 	outputRowPVCChan := make(chan *OutputRowPVC)
 	var sliceOfOutputRowPVC []*OutputRowPVC
+	var produceErr error
+	collectCtx, cancelCollect := context.WithCancel(ctx)
+	defer cancelCollect()
 
-	// produce concurrently
+	// produce concurrently; the interrupts only unblock the actors, the errors are reported by the caller, e.g. the
+	// failed nodes of a *NodeCollectionError with PrintNodeErrors
 	{
 		mainGroup.Add(func() error {
-			return ProduceOutputRowsConcurrently(ctx, clientset, desiredNamespace, sliceOfNodeName, outputRowPVCChan)
+			produceErr = collection.source.Collect(collectCtx, sliceOfNodeName, outputRowPVCChan)
+			return produceErr
 		}, func(err error) {
 			if err != nil {
-				log.Infof("TODO goroutine error handling; current actor was interrupted with: %v\n", err)
+				cancelCollect()
 			}
 		})
 	}
 
-	// consume concurrently
+	// consume concurrently; the consumer returns once the producer closes the channel, so there is nothing to interrupt
 	{
 		mainGroup.Add(func() error {
 			sliceOfOutputRowPVC = ConsumeOutputRowsConcurrently(outputRowPVCChan)
 			return nil
-		}, func(err error) {
-			if err != nil {
-				log.Infof("TODO goroutine error handling; current actor was interrupted with: %v\n", err)
-			}
-		})
+		}, func(error) {})
+	}
+
+	// the consumer may finish before the producer reports failed nodes, so don't rely on the group's first error
+	err = mainGroup.Run()
+	sliceOfOutputRowPVC, completeErr := flags.completeOutputRows(ctx, collection.claimIndex, collection.namespaceFilter, sliceOfOutputRowPVC)
+	if completeErr != nil {
+		return nil, nil, completeErr
+	}
+	if flags.needsOwners() && collection.clientset != nil {
+		NewWorkloadOwnerIndex(collection.clientset, collection.namespaceFilter.SingleNamespace()).ResolveOwners(ctx, sliceOfOutputRowPVC)
+	}
+	if err != nil && produceErr == nil {
+		return sliceOfOutputRowPVC, sliceOfNodeName, err
 	}
+	return sliceOfOutputRowPVC, sliceOfNodeName, produceErr
+}
+
+// withRequestTimeout bounds ctx by --request-timeout, which applies to the whole collection, not only each request
+func (flags *flagpole) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	requestTimeout, err := GetRequestTimeoutFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if requestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// newClientset creates a clientset from the kubeconfig flags
+func (flags *flagpole) newClientset() (kubernetes.Interface, error) {
+	kubeConfig, err := GetKubeConfigFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build config from flags")
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create clientset")
+	}
+	return clientset, nil
+}
+
+// resolveNamespaceFilter builds the namespace filter, resolving --namespace-selector against the cluster
+func (flags *flagpole) resolveNamespaceFilter(ctx context.Context, clientset kubernetes.Interface) (*NamespaceFilter, error) {
+	namespaceFilter, err := flags.namespaceFilter()
+	if err != nil {
+		return nil, err
+	}
+	if 0 < len(flags.namespaceSelector) {
+		if err := namespaceFilter.RestrictToLabelSelector(ctx, clientset, flags.namespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+	return namespaceFilter, nil
+}
 
-	return sliceOfOutputRowPVC, mainGroup.Run()
+// completeOutputRows adds the unmounted PVCs with --all and drops the annotations with --ignore-annotations
+func (flags *flagpole) completeOutputRows(ctx context.Context, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter, sliceOfOutputRowPVC []*OutputRowPVC) ([]*OutputRowPVC, error) {
+	if flags.all {
+		unmountedRows, err := claimIndex.UnmountedOutputRows(ctx, namespaceFilter, sliceOfOutputRowPVC)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list the unmounted PVCs")
+		}
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, unmountedRows...)
+	}
+	if flags.ignoreAnnotations {
+		dropAnnotations(sliceOfOutputRowPVC)
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+// GetNodesToQuery returns the nodes hosting pods with PVCs in the selected namespaces, or all nodes when every
+// namespace is selected
+func GetNodesToQuery(ctx context.Context, clientset kubernetes.Interface, namespaceFilter *NamespaceFilter) ([]string, error) {
+	var sliceOfNodeName []string
+	if namespaceFilter.IsAllNamespaces() {
+		nodes, err := ListNodes(ctx, clientset)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list nodes")
+		}
+		for _, node := range nodes.Items {
+			sliceOfNodeName = append(sliceOfNodeName, node.Name)
+		}
+		return sliceOfNodeName, nil
+	}
+	nodeNameToPodNames, err := GetWhichNodesToQueryBasedOnNamespace(ctx, clientset, namespaceFilter)
+	if err != nil {
+		return nil, err
+	}
+	for nodeName := range nodeNameToPodNames {
+		sliceOfNodeName = append(sliceOfNodeName, nodeName)
+	}
+	return sliceOfNodeName, nil
 }
 
 // ConsumeOutputRowsConcurrently consumes processed output rows concurrently
@@ -565,91 +1316,148 @@ func ConsumeOutputRowsConcurrently(outputRowPVCChan <-chan *OutputRowPVC) []*Out
 	return sliceOfOutputRowPVC
 }
 
-// ProduceOutputRowsConcurrently produces output rows concurrently
-func ProduceOutputRowsConcurrently(ctx context.Context, clientset *kubernetes.Clientset, desiredNamespace string, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+// ProduceOutputRowsConcurrently produces output rows concurrently using at most queryOptions.MaxConcurrency workers;
+// a failing node does not stop the others, instead a *NodeCollectionError listing every failed node is returned
+// once all nodes were queried
+func ProduceOutputRowsConcurrently(ctx context.Context, clientset kubernetes.Interface, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter, nodeNames []string, queryOptions NodeQueryOptions, outputRowPVCChan chan<- *OutputRowPVC) error {
 	producerCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	var producerGroup run.Group
+	nodeNameChan := make(chan string, len(nodeNames))
+	totalNodes := 0
 	for _, nodeName := range nodeNames {
-		nodeName := nodeName
 		if nodeName == "" {
 			log.Warnf("skipping empty node name")
 			continue
 		}
+		totalNodes++
+		nodeNameChan <- nodeName
+	}
+	close(nodeNameChan)
+
+	var producerGroup run.Group
+	var failedNodes nodeErrorRecorder
+	for worker := 0; worker < queryOptions.workers(totalNodes); worker++ {
 		producerGroup.Add(func() error {
-			return GetOutputRowPVCFromNode(producerCtx, clientset, desiredNamespace, nodeName, outputRowPVCChan)
+			for nodeName := range nodeNameChan {
+				if err := GetOutputRowPVCFromNode(producerCtx, clientset, claimIndex, namespaceFilter, nodeName, queryOptions, outputRowPVCChan); err != nil {
+					log.Debugf("failed to collect volume stats from node '%s': %v", nodeName, err)
+					failedNodes.record(nodeName, err)
+				}
+			}
+			return nil
 		}, func(err error) {
+			// workers return nil once the nodes run out, which must not cancel the others still querying theirs
 			if err != nil {
 				cancel()
-				log.Infof("TODO goroutine error handling; current actor was interrupted with: %v\n", err)
 			}
 		})
 	}
 	err := producerGroup.Run()
 	close(outputRowPVCChan)
-	return err
+	if err != nil {
+		return err
+	}
+	return failedNodes.result(totalNodes)
 }
 
 // GetOutputRowPVCFromNode gets the output row given a nodeName
-func GetOutputRowPVCFromNode(ctx context.Context, clientset *kubernetes.Clientset, desiredNamespace string, nodeName string, outputRowPVCChan chan<- *OutputRowPVC) error {
+func GetOutputRowPVCFromNode(ctx context.Context, clientset kubernetes.Interface, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter, nodeName string, queryOptions NodeQueryOptions, outputRowPVCChan chan<- *OutputRowPVC) error {
 	log.Tracef("connecting to node: %s", nodeName)
-	request := clientset.CoreV1().RESTClient().Get().Resource("nodes").Name(nodeName).SubResource("proxy").Suffix("stats/summary")
-	res := request.Do(ctx)
-
-	responseRawArrayOfBytes, err := res.Raw()
-	if err != nil {
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	responseRawArrayOfBytes, err := GetStatsSummaryFromNode(ctx, clientset, nodeName, queryOptions)
+	if isSummaryUnavailableError(err) {
+		// hardened nodes may disable or restrict the summary API while still exposing the kubelet metrics
+		log.Debugf("stats/summary of node '%s' is unavailable, falling back to its metrics: %v", nodeName, err)
+		metrics, metricsErr := GetMetricsFromNode(ctx, clientset, nodeName, queryOptions)
+		if metricsErr != nil {
+			// the fallback failing tells more of the node than the summary it replaces, so it is the one classified
+			return errors.Wrapf(metricsErr, "failed to get stats from node (%v), and from its metrics", err)
+		}
+		sliceOfOutputRowPVC, err = GetOutputRowsFromKubeletMetrics(ctx, claimIndex, namespaceFilter, nodeName, metrics)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
 		return errors.Wrapf(err, "failed to get stats from node")
+	} else {
+		sliceOfOutputRowPVC, err = GetOutputRowsFromStatsSummary(ctx, claimIndex, namespaceFilter, nodeName, responseRawArrayOfBytes)
+		if err != nil {
+			return err
+		}
 	}
+	for _, outputRowPVC := range sliceOfOutputRowPVC {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case outputRowPVCChan <- outputRowPVC:
+			log.Debugf("Got metrics for pvc '%s' from node: '%s'", outputRowPVC.PVCName, nodeName)
+		}
+	}
+	return nil
+}
 
+// GetOutputRowsFromStatsSummary gets the output rows from the stats/summary response of a node, whether just
+// queried or replayed from a file
+func GetOutputRowsFromStatsSummary(ctx context.Context, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter, nodeName string, responseRawArrayOfBytes []byte) ([]*OutputRowPVC, error) {
 	// for trace logging only
 	var nodeRespBody interface{}
-	err = json.Unmarshal(responseRawArrayOfBytes, &nodeRespBody)
+	err := json.Unmarshal(responseRawArrayOfBytes, &nodeRespBody)
 	if err != nil {
-		return errors.Wrapf(err, "unable to unmarshal json into an interface (this really shouldn't happen)")
+		return nil, errors.Wrapf(err, "unable to unmarshal json into an interface (this really shouldn't happen)")
 	}
 	// log.Tracef("response from node: %+v\n", nodeRespBody)
 	jsonText, err := json.Marshal(nodeRespBody)
 	// jsonText, err := json.MarshalIndent(nodeRespBody, "", "  ")
 	if err != nil {
-		return errors.Wrapf(err, "unable to marshal json (this really shouldn't happen)")
+		return nil, errors.Wrapf(err, "unable to marshal json (this really shouldn't happen)")
 	}
 	log.Tracef("response from node: %s", jsonText)
 
 	var jsonConvertedIntoStruct ServerResponseStruct
 	err = json.Unmarshal(responseRawArrayOfBytes, &jsonConvertedIntoStruct)
 	if err != nil {
-		return errors.Wrapf(err, "failed to convert the response from server")
+		return nil, errors.Wrapf(err, "failed to convert the response from server")
 	}
 
+	var sliceOfOutputRowPVC []*OutputRowPVC
 	for _, pod := range jsonConvertedIntoStruct.Pods {
 		for _, vol := range pod.ListOfVolumes {
-			outputRowPVC := GetOutputRowPVCFromPodAndVolume(ctx, clientset, pod, vol, desiredNamespace)
+			outputRowPVC, err := GetOutputRowPVCFromPodAndVolume(ctx, claimIndex, pod, vol, namespaceFilter)
+			if isUnresolvedClaimError(err) {
+				log.Warnf("skipping volume '%s' of pod '%s/%s' on node '%s': %v", vol.Name, pod.PodRef.Namespace, pod.PodRef.Name, nodeName, err)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
 			if nil == outputRowPVC {
-				log.Tracef("no pvc found for pod: '%s', vol: '%s', desiredNamespace: '%s'; continuing...", pod.PodRef.Name, vol.PvcRef.PvcName, desiredNamespace)
+				log.Tracef("no pvc found for pod: '%s', vol: '%s', namespaces: '%s'; continuing...", pod.PodRef.Name, vol.PvcRef.PvcName, namespaceFilter)
 				continue
 			}
 			outputRowPVC.NodeName = nodeName
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case outputRowPVCChan <- outputRowPVC:
-				log.Debugf("Got metrics for pvc '%s' from node: '%s'", outputRowPVC.PVCName, nodeName)
-			}
+			sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, outputRowPVC)
 		}
 	}
-	return nil
+	return sliceOfOutputRowPVC, nil
 }
 
-// GetWhichNodesToQueryBasedOnNamespace gets a list of nodes to query for all the pods in a namespace
-func GetWhichNodesToQueryBasedOnNamespace(ctx context.Context, clientset *kubernetes.Clientset, desiredNamespace string) (map[string][]string, error) {
-	sliceOfPod, err := ListPodsWithPersistentVolumeClaims(ctx, clientset, desiredNamespace)
+// GetWhichNodesToQueryBasedOnNamespace gets a list of nodes to query for all the pods in the selected namespaces
+func GetWhichNodesToQueryBasedOnNamespace(ctx context.Context, clientset kubernetes.Interface, namespaceFilter *NamespaceFilter) (map[string][]string, error) {
+	nodeNameToPodNames := make(map[string][]string)
+	if namespaceFilter != nil && namespaceFilter.Include != nil && 0 == len(namespaceFilter.Include) {
+		log.Debugf("no namespaces selected; not querying any nodes")
+		return nodeNameToPodNames, nil
+	}
+
+	sliceOfPod, err := ListPodsWithPersistentVolumeClaims(ctx, clientset, namespaceFilter.SingleNamespace())
 	if err != nil {
 		return nil, err
 	}
 
-	nodeNameToPodNames := make(map[string][]string)
 	for _, pod := range sliceOfPod {
+		if !namespaceFilter.Matches(pod.Namespace) {
+			continue
+		}
 		nodeName := pod.Spec.NodeName
 		podName := pod.Name
 		nodeNameToPodNames[nodeName] = append(nodeNameToPodNames[nodeName], podName)
@@ -657,30 +1465,23 @@ func GetWhichNodesToQueryBasedOnNamespace(ctx context.Context, clientset *kubern
 	return nodeNameToPodNames, nil
 }
 
-// GetOutputRowPVCFromPodAndVolume gets an output row for a given pod, volume and optionally namespace
-func GetOutputRowPVCFromPodAndVolume(ctx context.Context, clientset *kubernetes.Clientset, pod *Pod, vol *Volume, desiredNamespace string) *OutputRowPVC {
+// GetOutputRowPVCFromPodAndVolume gets an output row for a given pod, volume and optionally namespaces
+func GetOutputRowPVCFromPodAndVolume(ctx context.Context, claimIndex *VolumeClaimIndex, pod *Pod, vol *Volume, namespaceFilter *NamespaceFilter) (*OutputRowPVC, error) {
 	var outputRowPVC *OutputRowPVC
 
-	if 0 < len(desiredNamespace) {
-		if vol.PvcRef.PvcNamespace != desiredNamespace {
-			return nil
+	if !namespaceFilter.IsAllNamespaces() {
+		if !namespaceFilter.Matches(vol.PvcRef.PvcNamespace) {
+			return nil, nil
 		}
 	}
-	log.Debugf("restricting findings to namespace: '%s'", desiredNamespace)
+	log.Debugf("restricting findings to namespace/s: '%s'", namespaceFilter)
 
 	if 0 < len(vol.PvcRef.PvcName) {
 		namespace := pod.PodRef.Namespace
 		pvcName := vol.PvcRef.PvcName
-		pvName, _ := GetPVNameFromPVCName(ctx, clientset, namespace, pvcName)
-		// if err != nil {
-		// 	ctx.Err()
-		// 	return errors.Wrapf(err, "unable to get PV name from the PVC name")
-		// }
-
 		outputRowPVC = &OutputRowPVC{
 			Namespace:       namespace,
 			PVCName:         pvcName,
-			PVName:          pvName,
 			PodName:         pod.PodRef.Name,
 			VolumeMountName: vol.Name,
 			AvailableBytes:  resource.NewQuantity(vol.AvailableBytes, resource.BinarySI),
@@ -692,24 +1493,49 @@ func GetOutputRowPVCFromPodAndVolume(ctx context.Context, clientset *kubernetes.
 			InodesUsed:      vol.InodesUsed,
 			PercentageIUsed: (float64(vol.InodesUsed) / float64(vol.Inodes)) * 100.0,
 		}
+		// summaries replayed without the PVCs they were captured with can only report what the kubelet knows
+		if claimIndex.withoutClaims {
+			return outputRowPVC, nil
+		}
+
+		pvName, err := claimIndex.GetPVName(ctx, namespace, pvcName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get PV name from the PVC name")
+		}
+		pvc, err := claimIndex.GetPVC(ctx, namespace, pvcName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get the PVC")
+		}
+		outputRowPVC.PVName = pvName
+		EnrichOutputRowFromClaim(outputRowPVC, pvc, claimIndex.GetPV(ctx, pvName))
+		outputRowPVC.ThresholdOverrides, outputRowPVC.Ignored = ParseVolumeAnnotations(pvcKey(namespace, pvcName), pvc.Annotations)
 	}
-	return outputRowPVC
+	return outputRowPVC, nil
 }
 
-// GetKubeConfigFromGenericCliConfigFlags gets the kubeconfig from all the flags
+// GetKubeConfigFromGenericCliConfigFlags gets the kubeconfig from all the flags, falling back to the in-cluster
+// config when there is no kubeconfig at all (e.g. when running as a pod)
 func GetKubeConfigFromGenericCliConfigFlags(genericCliConfigFlags *genericclioptions.ConfigFlags) (*rest.Config, error) {
 	config, err := genericCliConfigFlags.ToRESTConfig()
+	if clientcmd.IsEmptyConfig(err) {
+		inClusterConfig, inClusterErr := rest.InClusterConfig()
+		if inClusterErr == nil {
+			log.Debugf("no kubeconfig found; using in-cluster config")
+			return inClusterConfig, nil
+		}
+		log.Debugf("no kubeconfig found and in-cluster config is unavailable: %v", inClusterErr)
+	}
 	return config, errors.Wrap(err, "failed to read kubeconfig")
 }
 
 // ListNodes returns a list of nodes
-func ListNodes(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.NodeList, error) {
+func ListNodes(ctx context.Context, clientset kubernetes.Interface) (*corev1.NodeList, error) {
 	log.Tracef("getting a list of all nodes")
 	return clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 }
 
 // ListPods returns a list of pods
-func ListPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.PodList, error) {
+func ListPods(ctx context.Context, clientset kubernetes.Interface, namespace string) (*corev1.PodList, error) {
 	log.Tracef("getting a list of all pods in namespace: %s", namespace)
 	return clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 }
@@ -717,7 +1543,7 @@ func ListPods(ctx context.Context, clientset *kubernetes.Clientset, namespace st
 // ListPodsWithPersistentVolumeClaims returns a list of pods with PVCs
 // kubectl get pods --all-namespaces -o=json | jq -c \
 // '.items[] | {name: .metadata.name, namespace: .metadata.namespace, claimName:.spec.volumes[] | select( has ("persistentVolumeClaim") ).persistentVolumeClaim.claimName }'
-func ListPodsWithPersistentVolumeClaims(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]corev1.Pod, error) {
+func ListPodsWithPersistentVolumeClaims(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]corev1.Pod, error) {
 	log.Tracef("getting a list of pods with PVC in namespace: %s", namespace)
 	pods, err := ListPods(ctx, clientset, namespace)
 	if err != nil {
@@ -737,7 +1563,7 @@ func ListPodsWithPersistentVolumeClaims(ctx context.Context, clientset *kubernet
 }
 
 // GetPVNameFromPVCName returns the name of persistent volume given a namespace and persistent volume claim name
-func GetPVNameFromPVCName(ctx context.Context, clientset *kubernetes.Clientset, namespace string, pvcName string) (string, error) {
+func GetPVNameFromPVCName(ctx context.Context, clientset kubernetes.Interface, namespace string, pvcName string) (string, error) {
 	var pvName string
 	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
 	if err != nil {
@@ -758,19 +1584,13 @@ func KubeConfigPath() (string, error) {
 }
 
 // ListPVCs returns a list of PVCs for a given namespace
-func ListPVCs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.PersistentVolumeClaimList, error) {
+func ListPVCs(ctx context.Context, clientset kubernetes.Interface, namespace string) (*corev1.PersistentVolumeClaimList, error) {
 	log.Tracef("getting a list of all PVCs in namespace: %s", namespace)
 	return clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
 }
 
-// ListPVs returns a list of PVs, scoped to corresponding mapped PVCs based on the namespace
-func ListPVs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) {
-	pvList, _ := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
-	var pvcNames []string
-	for _, pv := range pvList.Items {
-		if pv.Spec.ClaimRef.Name == namespace {
-			pvcName := pv.Spec.ClaimRef.Name
-			pvcNames = append(pvcNames, pvcName)
-		}
-	}
+// ListPVs returns a list of all PVs
+func ListPVs(ctx context.Context, clientset kubernetes.Interface) (*corev1.PersistentVolumeList, error) {
+	log.Tracef("getting a list of all PVs")
+	return clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
 }
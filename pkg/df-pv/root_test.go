@@ -1,17 +1,28 @@
 package df_pv
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -32,7 +43,7 @@ func TestPrintUsingGoPrettySelectsRequestedColumns(t *testing.T) {
 
 	var printErr error
 	output := captureStdout(t, func() {
-		printErr = PrintUsingGoPretty(rows, true, "pv,size")
+		printErr = PrintUsingGoPretty(rows, true, "pv,size", DefaultThresholds)
 	})
 	if printErr != nil {
 		t.Fatalf("PrintUsingGoPretty returned unexpected error: %v", printErr)
@@ -48,6 +59,67 @@ func TestPrintUsingGoPrettySelectsRequestedColumns(t *testing.T) {
 	}
 }
 
+func TestPrintDelimitedEmitsRawBytesAndQuotesNames(t *testing.T) {
+	rows := []*OutputRowPVC{{
+		PVName:         "pv-a",
+		PVCName:        "pvc,with\"comma",
+		CapacityBytes:  resource.NewQuantity(10<<30, resource.BinarySI),
+		UsedBytes:      resource.NewQuantity(2<<30, resource.BinarySI),
+		AvailableBytes: resource.NewQuantity(8<<30, resource.BinarySI),
+		PercentageUsed: 20,
+	}}
+
+	tests := []struct {
+		name      string
+		delimiter rune
+		noHeaders bool
+		want      string
+	}{
+		{
+			name:      "csv",
+			delimiter: ',',
+			want:      "pvc,size,%used\n\"pvc,with\"\"comma\",10737418240,20.00\n",
+		},
+		{
+			name:      "tsv without headers",
+			delimiter: '\t',
+			noHeaders: true,
+			want:      "\"pvc,with\"\"comma\"\t10737418240\t20.00\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := PrintDelimited(&buf, rows, "pvc,size,%used", tt.delimiter, tt.noHeaders); err != nil {
+				t.Fatalf("PrintDelimited returned unexpected error: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Fatalf("PrintDelimited output = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGoPrettyRowDoesNotColorUnknownUsage(t *testing.T) {
+	row := goPrettyRow(newTestRow("ns-a", "pvc-a", 0, 0), []string{"size"}, DefaultThresholds)
+	if got, want := row[0], ConvertQuantityValueToHumanReadableIECString(resource.NewQuantity(0, resource.BinarySI)); got != want {
+		t.Fatalf("size of a volume with unknown usage = %q, want uncolored %q", got, want)
+	}
+}
+
+func TestPrintDelimitedLeavesUnknownPercentagesEmpty(t *testing.T) {
+	rows := []*OutputRowPVC{withPercentageIUsed(newTestRow("ns-a", "pvc-a", 0, 0), math.NaN())}
+
+	var buf bytes.Buffer
+	if err := PrintDelimited(&buf, rows, "pvc,%used,%iused", ',', true); err != nil {
+		t.Fatalf("PrintDelimited returned unexpected error: %v", err)
+	}
+	if want := "pvc-a,,\n"; buf.String() != want {
+		t.Fatalf("PrintDelimited output = %q, want %q", buf.String(), want)
+	}
+}
+
 func captureStdout(t *testing.T, fn func()) string {
 	t.Helper()
 
@@ -172,7 +244,7 @@ func TestProduceOutputRowsConcurrentlySkipsEmptyNodeNames(t *testing.T) {
 	result := make(chan error, 1)
 
 	go func() {
-		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, "", []string{""}, outputRowPVCChan)
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{""}, NodeQueryOptions{}, outputRowPVCChan)
 	}()
 
 	select {
@@ -204,7 +276,7 @@ func TestProduceOutputRowsConcurrentlyClosesChannelOnNodeError(t *testing.T) {
 	result := make(chan error, 1)
 
 	go func() {
-		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, "", []string{"node-a"}, outputRowPVCChan)
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{"node-a"}, NodeQueryOptions{}, outputRowPVCChan)
 	}()
 
 	select {
@@ -247,3 +319,235 @@ func newTestClientset(t *testing.T, statusCode int) (*kubernetes.Clientset, *int
 
 	return clientset, &requestCount
 }
+
+// fakeCluster serves just enough of the kube-apiserver for the collection pipeline
+type fakeCluster struct {
+	mu sync.Mutex
+	// nodes are listed when running the whole command; the tests of the sources give them the node names
+	nodes          []corev1.Node
+	nodeSummaries  map[string]string
+	nodeMetrics    map[string]string
+	nodeStatusCode map[string]int
+	// summaryStatusCode fails the stats/summary endpoint of a node only, unlike nodeStatusCode
+	summaryStatusCode map[string]int
+	pods              []corev1.Pod
+	pvcs              []corev1.PersistentVolumeClaim
+	pvs               []corev1.PersistentVolume
+	replicaSets       []appsv1.ReplicaSet
+	jobs              []batchv1.Job
+	requestedPaths    []string
+}
+
+func (c *fakeCluster) requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requestedPaths...)
+}
+
+func newFakeClusterClientset(t *testing.T, cluster *fakeCluster) *kubernetes.Clientset {
+	t.Helper()
+
+	return newHandlerClientset(t, cluster.serveHTTP)
+}
+
+func (c *fakeCluster) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.requestedPaths = append(c.requestedPaths, r.URL.Path)
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/api/v1/nodes":
+		_ = json.NewEncoder(w).Encode(&corev1.NodeList{Items: c.nodes})
+	case r.URL.Path == "/api/v1/pods":
+		_ = json.NewEncoder(w).Encode(&corev1.PodList{Items: c.pods})
+	case r.URL.Path == "/api/v1/persistentvolumeclaims":
+		_ = json.NewEncoder(w).Encode(&corev1.PersistentVolumeClaimList{Items: c.pvcs})
+	case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/") && strings.Contains(r.URL.Path, "/persistentvolumeclaims/"):
+		segments := strings.Split(r.URL.Path, "/")
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, pvc := range c.pvcs {
+			if pvc.Namespace == segments[4] && pvc.Name == segments[6] {
+				_ = json.NewEncoder(w).Encode(&pvc)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.URL.Path == "/api/v1/persistentvolumes":
+		_ = json.NewEncoder(w).Encode(&corev1.PersistentVolumeList{Items: c.pvs})
+	case r.URL.Path == "/apis/apps/v1/replicasets":
+		_ = json.NewEncoder(w).Encode(&appsv1.ReplicaSetList{Items: c.replicaSets})
+	case r.URL.Path == "/apis/batch/v1/jobs":
+		_ = json.NewEncoder(w).Encode(&batchv1.JobList{Items: c.jobs})
+	case strings.HasPrefix(r.URL.Path, "/api/v1/nodes/") && strings.HasSuffix(r.URL.Path, "/proxy/stats/summary"):
+		nodeName := strings.Split(r.URL.Path, "/")[4]
+		if statusCode, ok := c.nodeStatusCode[nodeName]; ok {
+			http.Error(w, "test node error", statusCode)
+			return
+		}
+		if statusCode, ok := c.summaryStatusCode[nodeName]; ok {
+			http.Error(w, "test summary error", statusCode)
+			return
+		}
+		summary, ok := c.nodeSummaries[nodeName]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, summary)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/nodes/") && strings.HasSuffix(r.URL.Path, "/proxy/metrics"):
+		nodeName := strings.Split(r.URL.Path, "/")[4]
+		if statusCode, ok := c.nodeStatusCode[nodeName]; ok {
+			http.Error(w, "test node error", statusCode)
+			return
+		}
+		metrics, ok := c.nodeMetrics[nodeName]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = io.WriteString(w, metrics)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newHandlerClientset(t *testing.T, handler http.HandlerFunc) *kubernetes.Clientset {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create test clientset: %v", err)
+	}
+	return clientset
+}
+
+// newTestRow returns the row of the PVC namespace/pvc using usedBytes of capacityBytes and 10 of 100 inodes;
+// tests set whatever else they need on it, e.g. its pod, node or owner
+func newTestRow(namespace string, pvc string, capacityBytes int64, usedBytes int64) *OutputRowPVC {
+	return &OutputRowPVC{
+		Namespace:       namespace,
+		PVCName:         pvc,
+		VolumeMountName: "data",
+		CapacityBytes:   resource.NewQuantity(capacityBytes, resource.BinarySI),
+		UsedBytes:       resource.NewQuantity(usedBytes, resource.BinarySI),
+		AvailableBytes:  resource.NewQuantity(capacityBytes-usedBytes, resource.BinarySI),
+		PercentageUsed:  float64(usedBytes) / float64(capacityBytes) * 100,
+		Inodes:          100,
+		InodesUsed:      10,
+		InodesFree:      90,
+		PercentageIUsed: 10,
+	}
+}
+
+// withConsumer sets the pod and node mounting the volume of a row
+func withConsumer(row *OutputRowPVC, podName string, nodeName string) *OutputRowPVC {
+	row.PodName, row.NodeName = podName, nodeName
+	return row
+}
+
+// withPercentageIUsed overrides the %iused of a row, e.g. with NaN for a volume that does not report inodes
+func withPercentageIUsed(row *OutputRowPVC, percentageIUsed float64) *OutputRowPVC {
+	row.PercentageIUsed = percentageIUsed
+	return row
+}
+
+// newPodWithPVC returns a running pod whose container "main" mounts claimName at /data
+func newPodWithPVC(namespace string, name string, nodeName string, claimName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			NodeName:   nodeName,
+			Containers: []corev1.Container{{Name: "main", VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}}},
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+		},
+	}
+}
+
+// withMount renames the container of a pod from newPodWithPVC and moves its mount of the claim to mountPath
+func withMount(pod *corev1.Pod, containerName string, mountPath string) *corev1.Pod {
+	pod.Spec.Containers[0].Name = containerName
+	pod.Spec.Containers[0].VolumeMounts[0].MountPath = mountPath
+	pod.Status.ContainerStatuses[0].Name = containerName
+	return pod
+}
+
+func newBoundPVC(namespace string, name string, pvName string) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: pvName},
+	}
+}
+
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	originalStderr := os.Stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() failed: %v", err)
+	}
+	os.Stderr = writer
+	log.SetOutput(writer)
+	fn()
+	log.SetOutput(originalStderr)
+	os.Stderr = originalStderr
+	if err := writer.Close(); err != nil {
+		t.Fatalf("closing captured stderr failed: %v", err)
+	}
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading captured stderr failed: %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("closing captured stderr reader failed: %v", err)
+	}
+	return string(output)
+}
+
+func TestRootCommandReportsPartialResultsOnStderr(t *testing.T) {
+	summary := `{"pods":[{"podRef":{"name":"db-0","namespace":"team-a"},"volume":[{"name":"data","capacityBytes":100,"usedBytes":10,"availableBytes":90,"pvcRef":{"name":"data-db-0","namespace":"team-a"}}]}]}`
+	cluster := &fakeCluster{
+		pods:           []corev1.Pod{*newPodWithPVC("team-a", "db-0", "node-1", "data-db-0"), *newPodWithPVC("team-a", "db-1", "node-2", "data-db-1")},
+		pvcs:           []corev1.PersistentVolumeClaim{newBoundPVC("team-a", "data-db-0", "pvc-db-0"), newBoundPVC("team-a", "data-db-1", "pvc-db-1")},
+		nodes:          []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}},
+		nodeSummaries:  map[string]string{"node-1": summary},
+		nodeStatusCode: map[string]int{"node-2": http.StatusForbidden},
+	}
+	server := httptest.NewServer(http.HandlerFunc(cluster.serveHTTP))
+	t.Cleanup(server.Close)
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "config"))
+
+	var output string
+	var executeErr error
+	stderr := captureStderr(t, func() {
+		output, executeErr = executeRootCommand(t, "--server", server.URL, "-o", "csv", "--columns", "pvc,node")
+	})
+	var exitCodeErr *ExitCodeError
+	if !errors.As(executeErr, &exitCodeErr) || exitCodeErr.Code != exitCodePartialResults {
+		t.Fatalf("df-pv error = %v, want partial results", executeErr)
+	}
+	if want := "pvc,node\ndata-db-0,node-1\n"; output != want {
+		t.Fatalf("df-pv output = %q, want %q", output, want)
+	}
+	// the interrupted collection actors must not log the failure next to the report of the failed nodes
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "WARNING: failed to collect volume stats from 1 of 2 nodes") || !strings.HasPrefix(lines[1], "NODE") || !strings.HasPrefix(lines[2], "node-2") {
+		t.Fatalf("df-pv stderr =\n%s\nwant the report of the failed nodes only", stderr)
+	}
+}
@@ -0,0 +1,307 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// serverShutdownTimeout bounds how long in-flight scrapes may take once serve is asked to stop
+const serverShutdownTimeout = 5 * time.Second
+
+// volumeMetricLabels identify a volume, so that a volume mounted by several pods is one series and sum() counts it once
+var volumeMetricLabels = []string{"namespace", "persistentvolumeclaim", "persistentvolume"}
+
+var (
+	volumeUsedBytesDesc = prometheus.NewDesc("df_pv_volume_used_bytes",
+		"Number of used bytes in the persistent volume.", volumeMetricLabels, nil)
+	volumeCapacityBytesDesc = prometheus.NewDesc("df_pv_volume_capacity_bytes",
+		"Capacity in bytes of the persistent volume.", volumeMetricLabels, nil)
+	volumeAvailableBytesDesc = prometheus.NewDesc("df_pv_volume_available_bytes",
+		"Number of available bytes in the persistent volume.", volumeMetricLabels, nil)
+	volumeInodesDesc = prometheus.NewDesc("df_pv_volume_inodes",
+		"Maximum number of inodes in the persistent volume.", volumeMetricLabels, nil)
+	volumeInodesUsedDesc = prometheus.NewDesc("df_pv_volume_inodes_used",
+		"Number of used inodes in the persistent volume.", volumeMetricLabels, nil)
+	volumeInodesFreeDesc = prometheus.NewDesc("df_pv_volume_inodes_free",
+		"Number of free inodes in the persistent volume.", volumeMetricLabels, nil)
+	volumeInfoDesc = prometheus.NewDesc("df_pv_volume_info",
+		"Information about the persistent volume.", append(volumeMetricLabels, "storage_class"), nil)
+	volumeConsumerInfoDesc = prometheus.NewDesc("df_pv_volume_consumer_info",
+		"A pod mounting the persistent volume, with one series per pod.", append(volumeMetricLabels, "pod", "node"), nil)
+	nodeScrapeSuccessDesc = prometheus.NewDesc("df_pv_node_scrape_success",
+		"Whether the last collection of volume stats from the node succeeded.", []string{"node"}, nil)
+	nodeScrapeFailuresDesc = prometheus.NewDesc("df_pv_node_scrape_failures_total",
+		"Number of failed collections of volume stats from the node, by error class.", []string{"node", "class"}, nil)
+	collectionDurationDesc = prometheus.NewDesc("df_pv_collection_duration_seconds",
+		"Duration of the last collection of volume stats.", nil, nil)
+	lastCollectionSuccessDesc = prometheus.NewDesc("df_pv_last_collection_success_timestamp_seconds",
+		"Unix timestamp of the last collection of volume stats from at least one node.", nil, nil)
+)
+
+// VolumeStatsExporter is a prometheus collector exposing the volume stats of the latest collection
+type VolumeStatsExporter struct {
+	mu                    sync.RWMutex
+	rows                  []*OutputRowPVC
+	nodeNames             []string
+	failedNodes           map[string]*NodeError
+	nodeFailures          map[string]map[string]float64
+	collectionDuration    time.Duration
+	lastCollectionSuccess time.Time
+}
+
+// NewVolumeStatsExporter creates an exporter with nothing collected yet
+func NewVolumeStatsExporter() *VolumeStatsExporter {
+	return &VolumeStatsExporter{
+		failedNodes:  make(map[string]*NodeError),
+		nodeFailures: make(map[string]map[string]float64),
+	}
+}
+
+// Update replaces the exported stats with the result of a collection, given one row per mount; when the collection
+// failed before any node was queried, the previously collected volume stats are kept and only the collection
+// metrics are updated
+func (exporter *VolumeStatsExporter) Update(rows []*OutputRowPVC, nodeNames []string, err error, duration time.Duration, collectedAt time.Time) {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	exporter.collectionDuration = duration
+	var nodeCollectionErr *NodeCollectionError
+	if err != nil && !errors.As(err, &nodeCollectionErr) {
+		return
+	}
+
+	exporter.rows = rows
+	exporter.nodeNames = nodeNames
+	exporter.failedNodes = make(map[string]*NodeError)
+	if nodeCollectionErr != nil {
+		for _, failed := range nodeCollectionErr.FailedNodes {
+			exporter.failedNodes[failed.NodeName] = failed
+			if exporter.nodeFailures[failed.NodeName] == nil {
+				exporter.nodeFailures[failed.NodeName] = make(map[string]float64)
+			}
+			exporter.nodeFailures[failed.NodeName][failed.Class]++
+		}
+	}
+	if nodeCollectionErr == nil || nodeCollectionErr.IsPartial() {
+		exporter.lastCollectionSuccess = collectedAt
+	}
+}
+
+// Describe implements prometheus.Collector
+func (exporter *VolumeStatsExporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		volumeUsedBytesDesc, volumeCapacityBytesDesc, volumeAvailableBytesDesc,
+		volumeInodesDesc, volumeInodesUsedDesc, volumeInodesFreeDesc, volumeInfoDesc, volumeConsumerInfoDesc,
+		nodeScrapeSuccessDesc, nodeScrapeFailuresDesc, collectionDurationDesc, lastCollectionSuccessDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (exporter *VolumeStatsExporter) Collect(ch chan<- prometheus.Metric) {
+	exporter.mu.RLock()
+	defer exporter.mu.RUnlock()
+
+	for _, row := range uniqueVolumes(exporter.rows) {
+		labels := []string{row.Namespace, row.PVCName, row.PVName}
+		ch <- prometheus.MustNewConstMetric(volumeInfoDesc, prometheus.GaugeValue, 1, append(labels, row.StorageClass)...)
+		ch <- prometheus.MustNewConstMetric(volumeUsedBytesDesc, prometheus.GaugeValue, float64(quantityValue(row.UsedBytes)), labels...)
+		ch <- prometheus.MustNewConstMetric(volumeCapacityBytesDesc, prometheus.GaugeValue, float64(quantityValue(row.CapacityBytes)), labels...)
+		ch <- prometheus.MustNewConstMetric(volumeAvailableBytesDesc, prometheus.GaugeValue, float64(quantityValue(row.AvailableBytes)), labels...)
+		ch <- prometheus.MustNewConstMetric(volumeInodesDesc, prometheus.GaugeValue, float64(row.Inodes), labels...)
+		ch <- prometheus.MustNewConstMetric(volumeInodesUsedDesc, prometheus.GaugeValue, float64(row.InodesUsed), labels...)
+		ch <- prometheus.MustNewConstMetric(volumeInodesFreeDesc, prometheus.GaugeValue, float64(row.InodesFree), labels...)
+	}
+	// a pod mounting the same volume in several containers is one consumer
+	seenConsumers := make(map[string]bool)
+	for _, row := range exporter.rows {
+		consumerKey := volumeKey(row) + "/" + row.PodName
+		if row.PodName == "" || seenConsumers[consumerKey] {
+			continue
+		}
+		seenConsumers[consumerKey] = true
+		ch <- prometheus.MustNewConstMetric(volumeConsumerInfoDesc, prometheus.GaugeValue, 1, row.Namespace, row.PVCName, row.PVName, row.PodName, row.NodeName)
+	}
+
+	for _, nodeName := range exporter.nodeNames {
+		success := 1.0
+		if _, failed := exporter.failedNodes[nodeName]; failed {
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(nodeScrapeSuccessDesc, prometheus.GaugeValue, success, nodeName)
+	}
+	for nodeName, failuresByClass := range exporter.nodeFailures {
+		for class, failures := range failuresByClass {
+			ch <- prometheus.MustNewConstMetric(nodeScrapeFailuresDesc, prometheus.CounterValue, failures, nodeName, class)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(collectionDurationDesc, prometheus.GaugeValue, exporter.collectionDuration.Seconds())
+	if !exporter.lastCollectionSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastCollectionSuccessDesc, prometheus.GaugeValue, float64(exporter.lastCollectionSuccess.Unix()))
+	}
+}
+
+func setupServeCommand(flags *flagpole) *cobra.Command {
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve volume stats as prometheus metrics",
+		Long: `serve periodically collects volume stats, exactly like df-pv does, and exposes them as prometheus metrics
+
+The df_pv_volume_* gauges have one series per volume; df_pv_volume_consumer_info has one series per pod mounting it.
+Besides them, df_pv_node_scrape_success and df_pv_node_scrape_failures_total report the health of every queried node
+
+The volume stats are collected from any --source but probe
+
+When no kubeconfig is present (e.g. when running as a pod), the in-cluster config of the pod's service account is used`,
+		Args:         cobra.MaximumNArgs(0),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(flags)
+		},
+	}
+
+	serveCmd.Flags().StringVar(&flags.listenAddress, "listen-address", ":9717", "address to serve metrics on")
+	serveCmd.Flags().StringVar(&flags.metricsPath, "metrics-path", "/metrics", "path to serve metrics on")
+	serveCmd.Flags().DurationVar(&flags.scrapeInterval, "scrape-interval", time.Minute, "how often volume stats are collected")
+	addCollectionFlags(serveCmd.Flags(), flags)
+	addSourceFlags(serveCmd.Flags(), flags)
+
+	return serveCmd
+}
+
+// parseServe validates the flags of the serve command before any kubernetes access
+func (flags *flagpole) parseServe() error {
+	if flags.scrapeInterval <= 0 {
+		return fmt.Errorf("scrape-interval must be positive, got %s", flags.scrapeInterval)
+	}
+	if !strings.HasPrefix(flags.metricsPath, "/") {
+		return fmt.Errorf("metrics-path must start with '/', got %q", flags.metricsPath)
+	}
+	if _, err := flags.namespaceFilter(); err != nil {
+		return errors.Wrap(err, "invalid namespace selection")
+	}
+	if err := flags.validateSource(); err != nil {
+		return err
+	}
+	// serve has none of the --probe-* flags
+	if source, _ := flags.selectedSource(); source == sourceProbe {
+		return fmt.Errorf("the %s source is not supported by serve", sourceProbe)
+	}
+	if err := flags.nodeQueryOptions().validate(); err != nil {
+		return errors.Wrap(err, "invalid node query options")
+	}
+	_, err := GetRequestTimeoutFromGenericCliConfigFlags(flags.genericCliConfigFlags)
+	return err
+}
+
+func runServe(flags *flagpole) error {
+	if err := flags.parseServe(); err != nil {
+		return err
+	}
+
+	logLevel, _ := log.ParseLevel(flags.logLevel)
+	log.SetLevel(logLevel)
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+
+	exporter := NewVolumeStatsExporter()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	mux := http.NewServeMux()
+	mux.Handle(flags.metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	server := &http.Server{Addr: flags.listenAddress, Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var serveGroup run.Group
+	serveGroup.Add(run.SignalHandler(ctx, os.Interrupt, syscall.SIGTERM))
+
+	// collect periodically
+	{
+		serveGroup.Add(func() error {
+			return runCollectionLoop(ctx, flags, exporter)
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	// serve metrics
+	{
+		serveGroup.Add(func() error {
+			log.Infof("serving metrics on %s%s", flags.listenAddress, flags.metricsPath)
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				return errors.Wrap(err, "metrics server failed")
+			}
+			return nil
+		}, func(err error) {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+			defer shutdownCancel()
+			if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+				log.Warnf("unable to shut down metrics server gracefully: %v", shutdownErr)
+			}
+		})
+	}
+
+	if err := serveGroup.Run(); err != nil && !errors.Is(err, run.ErrSignal) {
+		return err
+	}
+	return nil
+}
+
+// runCollectionLoop collects volume stats into the exporter right away and then every --scrape-interval,
+// until ctx is done
+func runCollectionLoop(ctx context.Context, flags *flagpole, exporter *VolumeStatsExporter) error {
+	ticker := time.NewTicker(flags.scrapeInterval)
+	defer ticker.Stop()
+	for {
+		collectedAt := time.Now()
+		rows, nodeNames, err := getOutputRowsAndQueriedNodes(ctx, flags)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logCollectionError(err)
+		exporter.Update(rows, nodeNames, err, time.Since(collectedAt), collectedAt)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// logCollectionError logs why a collection failed, or which nodes failed
+func logCollectionError(err error) {
+	var nodeCollectionErr *NodeCollectionError
+	if !errors.As(err, &nodeCollectionErr) {
+		if err != nil {
+			log.Errorf("failed to collect volume stats: %v", err)
+		}
+		return
+	}
+	for _, failed := range nodeCollectionErr.FailedNodes {
+		log.Warnf("failed to collect volume stats from node '%s' (%s): %s", failed.NodeName, failed.Class, failed.Message)
+	}
+}
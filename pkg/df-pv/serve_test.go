@@ -0,0 +1,173 @@
+package df_pv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// gatherMetrics returns the gathered metrics of the exporter by name
+func gatherMetrics(t *testing.T, exporter *VolumeStatsExporter) map[string][]*dto.Metric {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	metrics := make(map[string][]*dto.Metric)
+	for _, family := range families {
+		metrics[family.GetName()] = family.GetMetric()
+	}
+	return metrics
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestVolumeStatsExporterExposesVolumesAndNodeHealth(t *testing.T) {
+	exporter := NewVolumeStatsExporter()
+	rows := []*OutputRowPVC{{
+		Namespace:       "ns-a",
+		PVCName:         "pvc-a",
+		PVName:          "pv-a",
+		NodeName:        "node-a",
+		PodName:         "pod-a",
+		VolumeMountName: "data",
+		StorageClass:    "fast",
+		CapacityBytes:   resource.NewQuantity(100, resource.BinarySI),
+		UsedBytes:       resource.NewQuantity(40, resource.BinarySI),
+		AvailableBytes:  resource.NewQuantity(60, resource.BinarySI),
+		Inodes:          10,
+		InodesUsed:      3,
+		InodesFree:      7,
+	}}
+	collectionErr := &NodeCollectionError{
+		FailedNodes: []*NodeError{{NodeName: "node-b", Class: nodeErrorClassForbidden, Message: "forbidden"}},
+		TotalNodes:  2,
+	}
+	collectedAt := time.Unix(1600000000, 0)
+	exporter.Update(rows, []string{"node-a", "node-b"}, collectionErr, 2*time.Second, collectedAt)
+	exporter.Update(rows, []string{"node-a", "node-b"}, collectionErr, 2*time.Second, collectedAt)
+
+	metrics := gatherMetrics(t, exporter)
+	used := metrics["df_pv_volume_used_bytes"]
+	if len(used) != 1 || used[0].GetGauge().GetValue() != 40 {
+		t.Fatalf("unexpected df_pv_volume_used_bytes: %v", used)
+	}
+	if len(used[0].GetLabel()) != 3 {
+		t.Fatalf("expected df_pv_volume_used_bytes to be labelled by its volume only, got %v", used[0].GetLabel())
+	}
+	for label, want := range map[string]string{"namespace": "ns-a", "persistentvolumeclaim": "pvc-a", "persistentvolume": "pv-a"} {
+		if got := labelValue(used[0], label); got != want {
+			t.Fatalf("label %s = %q, want %q", label, got, want)
+		}
+	}
+	if info := metrics["df_pv_volume_info"]; len(info) != 1 || labelValue(info[0], "storage_class") != "fast" {
+		t.Fatalf("unexpected df_pv_volume_info: %v", info)
+	}
+	if free := metrics["df_pv_volume_inodes_free"]; len(free) != 1 || free[0].GetGauge().GetValue() != 7 {
+		t.Fatalf("unexpected df_pv_volume_inodes_free: %v", free)
+	}
+
+	success := make(map[string]float64)
+	for _, metric := range metrics["df_pv_node_scrape_success"] {
+		success[labelValue(metric, "node")] = metric.GetGauge().GetValue()
+	}
+	if success["node-a"] != 1 || success["node-b"] != 0 || len(success) != 2 {
+		t.Fatalf("unexpected df_pv_node_scrape_success: %v", success)
+	}
+	failures := metrics["df_pv_node_scrape_failures_total"]
+	if len(failures) != 1 || failures[0].GetCounter().GetValue() != 2 || labelValue(failures[0], "class") != nodeErrorClassForbidden {
+		t.Fatalf("unexpected df_pv_node_scrape_failures_total: %v", failures)
+	}
+	if last := metrics["df_pv_last_collection_success_timestamp_seconds"]; len(last) != 1 || last[0].GetGauge().GetValue() != 1600000000 {
+		t.Fatalf("unexpected df_pv_last_collection_success_timestamp_seconds: %v", last)
+	}
+}
+
+func TestVolumeStatsExporterExportsSharedVolumesOnce(t *testing.T) {
+	exporter := NewVolumeStatsExporter()
+	var rows []*OutputRowPVC
+	for _, consumer := range []VolumeConsumer{{PodName: "web-1", NodeName: "node-b"}, {PodName: "web-0", NodeName: "node-a"}} {
+		rows = append(rows, &OutputRowPVC{Namespace: "ns-a", PVCName: "uploads", PVName: "pv-uploads", PodName: consumer.PodName, NodeName: consumer.NodeName, VolumeMountName: "uploads", UsedBytes: resource.NewQuantity(40, resource.BinarySI)})
+	}
+	exporter.Update(rows, []string{"node-a", "node-b"}, nil, time.Second, time.Unix(1600000000, 0))
+
+	metrics := gatherMetrics(t, exporter)
+	if used := metrics["df_pv_volume_used_bytes"]; len(used) != 1 || used[0].GetGauge().GetValue() != 40 {
+		t.Fatalf("expected one series for the shared volume, got %v", used)
+	}
+	consumers := make(map[string]string)
+	for _, metric := range metrics["df_pv_volume_consumer_info"] {
+		if labelValue(metric, "persistentvolume") != "pv-uploads" || metric.GetGauge().GetValue() != 1 {
+			t.Fatalf("unexpected df_pv_volume_consumer_info: %v", metric)
+		}
+		consumers[labelValue(metric, "pod")] = labelValue(metric, "node")
+	}
+	if len(consumers) != 2 || consumers["web-0"] != "node-a" || consumers["web-1"] != "node-b" {
+		t.Fatalf("expected one df_pv_volume_consumer_info series per pod, got %v", consumers)
+	}
+	if rows[0].PodName != "web-1" || rows[0].Consumers != nil {
+		t.Fatalf("Update modified the collected rows: %+v", rows[0])
+	}
+}
+
+func TestVolumeStatsExporterKeepsVolumesWhenCollectionFails(t *testing.T) {
+	exporter := NewVolumeStatsExporter()
+	rows := []*OutputRowPVC{{Namespace: "ns-a", PVCName: "pvc-a", UsedBytes: resource.NewQuantity(1, resource.BinarySI)}}
+	exporter.Update(rows, []string{"node-a"}, nil, time.Second, time.Unix(1600000000, 0))
+	exporter.Update(nil, nil, errors.New("failed to list nodes"), time.Second, time.Unix(1600000060, 0))
+
+	metrics := gatherMetrics(t, exporter)
+	if used := metrics["df_pv_volume_used_bytes"]; len(used) != 1 {
+		t.Fatalf("expected the previously collected volume to be kept, got %v", used)
+	}
+	if last := metrics["df_pv_last_collection_success_timestamp_seconds"]; last[0].GetGauge().GetValue() != 1600000000 {
+		t.Fatalf("last success timestamp moved on a failed collection: %v", last)
+	}
+}
+
+func TestStorageClassName(t *testing.T) {
+	fast := "fast"
+	pvc := newBoundPVC("ns", "pvc", "pv")
+	pv := &corev1.PersistentVolume{Spec: corev1.PersistentVolumeSpec{StorageClassName: "slow"}}
+	if got := StorageClassName(&pvc, pv); got != "slow" {
+		t.Fatalf("StorageClassName without a class on the claim = %q, want the PV's %q", got, "slow")
+	}
+	pvc.Spec.StorageClassName = &fast
+	if got := StorageClassName(&pvc, pv); got != "fast" {
+		t.Fatalf("StorageClassName = %q, want the claim's %q", got, "fast")
+	}
+	if got := StorageClassName(nil, nil); got != "" {
+		t.Fatalf("StorageClassName(nil, nil) = %q, want empty", got)
+	}
+}
+
+func TestServeSourceFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"serve", "--source", "probe"}, wantErr: "the probe source is not supported by serve"},
+		{args: []string{"serve", "--source", "prometheus"}, wantErr: "needs prometheus-url"},
+		{args: []string{"serve", "--source", "exec", "--kubelet-direct"}, wantErr: "cannot be combined with the exec source"},
+		{args: []string{"serve", "--from-dir", "testdata/dump", "--namespace-selector", "team=a"}, wantErr: "namespace-selector is not supported with from-file or from-dir"},
+	} {
+		if _, err := executeRootCommand(t, tc.args...); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("df-pv %v error = %v, want %q", tc.args, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package df_pv
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+var defaultSortOrder = []string{"namespace", "pvc"}
+
+// tieBreakerSortOrder keeps the output deterministic when the requested keys compare equal
+var tieBreakerSortOrder = []string{"namespace", "pvc", "pod", "mount", "node", "pv"}
+
+func parseSortBy(sortBy string) ([]string, error) {
+	if strings.TrimSpace(sortBy) == "" {
+		return append([]string(nil), defaultSortOrder...), nil
+	}
+	return parseColumnNames(sortBy)
+}
+
+// SortOutputRows sorts the output rows in place by the given columns, comparing numeric columns by value; values
+// that cannot be computed, e.g. the percentages of volumes not reporting their capacity, come last in both directions
+func SortOutputRows(sliceOfOutputRowPVC []*OutputRowPVC, sortBy []string, reverse bool) {
+	keys := append(append([]string(nil), sortBy...), tieBreakerSortOrder...)
+	sort.SliceStable(sliceOfOutputRowPVC, func(i, j int) bool {
+		return compareOutputRows(sliceOfOutputRowPVC[i], sliceOfOutputRowPVC[j], keys, reverse) < 0
+	})
+}
+
+func compareOutputRows(a *OutputRowPVC, b *OutputRowPVC, keys []string, reverse bool) int {
+	for _, colName := range keys {
+		def, ok := allColumns[colName]
+		if !ok {
+			continue
+		}
+		if result := compareColumn(def, a, b, reverse); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func compareColumn(def columnDef, a *OutputRowPVC, b *OutputRowPVC, reverse bool) int {
+	var result int
+	if def.numeric != nil {
+		aVal, bVal := def.numeric(a), def.numeric(b)
+		switch aUnknown, bUnknown := isUnknownValue(aVal), isUnknownValue(bVal); {
+		case aUnknown && bUnknown:
+			return 0
+		case aUnknown:
+			return 1
+		case bUnknown:
+			return -1
+		case aVal < bVal:
+			result = -1
+		case aVal > bVal:
+			result = 1
+		}
+	} else {
+		result = strings.Compare(fmt.Sprint(def.value(a)), fmt.Sprint(def.value(b)))
+	}
+	if reverse {
+		return -result
+	}
+	return result
+}
+
+// isUnknownValue reports whether a numeric column value could not be computed, like a percentage of a volume
+// reporting no capacity (0/0 is NaN, anything else divided by 0 is infinite)
+func isUnknownValue(value float64) bool {
+	return math.IsNaN(value) || math.IsInf(value, 0)
+}
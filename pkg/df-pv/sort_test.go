@@ -0,0 +1,94 @@
+package df_pv
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func pvcNames(rows []*OutputRowPVC) []string {
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.PVCName)
+	}
+	return names
+}
+
+func TestSortOutputRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		sortBy  string
+		reverse bool
+		want    []string
+	}{
+		{
+			name:   "default orders by namespace then pvc",
+			sortBy: "",
+			want:   []string{"a-1", "a-2", "b-1", "b-2"},
+		},
+		{
+			name:   "size compares numerically, not lexically",
+			sortBy: "size",
+			want:   []string{"b-2", "a-2", "a-1", "b-1"},
+		},
+		{
+			name:   "multiple keys",
+			sortBy: "%used,namespace",
+			want:   []string{"a-2", "b-1", "a-1", "b-2"},
+		},
+		{
+			name:    "reverse",
+			sortBy:  "%used,namespace",
+			reverse: true,
+			want:    []string{"b-2", "a-1", "b-1", "a-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := []*OutputRowPVC{
+				newTestRow("b", "b-2", 512, 448),
+				newTestRow("a", "a-1", 10<<30, 5<<30),
+				newTestRow("b", "b-1", 100<<30, 20<<30),
+				newTestRow("a", "a-2", 2<<30, 256<<20),
+			}
+			sortBy, err := parseSortBy(tt.sortBy)
+			if err != nil {
+				t.Fatalf("parseSortBy(%q) returned unexpected error: %v", tt.sortBy, err)
+			}
+			SortOutputRows(rows, sortBy, tt.reverse)
+			if got := pvcNames(rows); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("SortOutputRows(%q, reverse=%t) = %v, want %v", tt.sortBy, tt.reverse, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortOutputRowsPutsUnknownPercentagesLast(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		rows := []*OutputRowPVC{
+			newTestRow("ns", "unknown-1", 100, 10),
+			newTestRow("ns", "low", 100, 10),
+			newTestRow("ns", "unknown-2", 100, 10),
+			newTestRow("ns", "high", 100, 90),
+		}
+		rows[0].PercentageUsed, rows[2].PercentageUsed = math.NaN(), math.Inf(1)
+
+		SortOutputRows(rows, []string{"%used"}, reverse)
+		want := []string{"low", "high", "unknown-1", "unknown-2"}
+		if reverse {
+			want = []string{"high", "low", "unknown-2", "unknown-1"}
+		}
+		if got := pvcNames(rows); !reflect.DeepEqual(got, want) {
+			t.Fatalf("SortOutputRows(%%used, reverse=%t) = %v, want %v", reverse, got, want)
+		}
+	}
+}
+
+func TestParseSortByRejectsUnknownColumn(t *testing.T) {
+	_, err := parseSortBy("size,bogus")
+	if err == nil || !strings.Contains(err.Error(), `unknown column "bogus"`) {
+		t.Fatalf("parseSortBy error = %v, want unknown-column message", err)
+	}
+}
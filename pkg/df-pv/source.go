@@ -0,0 +1,297 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// --source values; kubelet and probe can also be chosen with their shorthands --kubelet-direct and --probe-hostpath
+const (
+	sourceNodeProxy  = "proxy"
+	sourceKubelet    = "kubelet"
+	sourceFiles      = "files"
+	sourcePrometheus = "prometheus"
+	sourceExec       = "exec"
+	// sourceProbe also marks the rows measured by a probe pod
+	sourceProbe = "probe"
+)
+
+var availableSources = []string{sourceNodeProxy, sourceKubelet, sourceFiles, sourcePrometheus, sourceExec, sourceProbe}
+
+// StatsSource is where the volume stats are collected from
+type StatsSource interface {
+	// Nodes returns the nodes to collect the volume stats of
+	Nodes(ctx context.Context) ([]string, error)
+	// Collect sends the rows of the given nodes to outputRowPVCChan and closes it once done; a failing node does not
+	// stop the others, instead the failed nodes are returned as a *NodeCollectionError
+	Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error
+}
+
+// parseSource validates the --source flag; it defaults to files when files are given, to the node proxy otherwise
+func parseSource(source string, offline bool) (string, error) {
+	source = strings.TrimSpace(strings.ToLower(source))
+	if source == "" {
+		if offline {
+			return sourceFiles, nil
+		}
+		return sourceNodeProxy, nil
+	}
+	valid := false
+	for _, availableSource := range availableSources {
+		valid = valid || source == availableSource
+	}
+	if !valid {
+		return "", fmt.Errorf("unknown source %q; valid values are [%s]", source, strings.Join(availableSources, ", "))
+	}
+	if source == sourceFiles && !offline {
+		return "", fmt.Errorf("the %s source needs from-file or from-dir", sourceFiles)
+	}
+	if source != sourceFiles && offline {
+		return "", fmt.Errorf("from-file and from-dir can only be used with the %s source", sourceFiles)
+	}
+	return source, nil
+}
+
+// NodeProxyStatsSource queries the stats/summary endpoint of every node through the API server's node proxy, or
+// directly for the kubelet source
+type NodeProxyStatsSource struct {
+	Clientset       kubernetes.Interface
+	ClaimIndex      *VolumeClaimIndex
+	NamespaceFilter *NamespaceFilter
+	QueryOptions    NodeQueryOptions
+}
+
+// Nodes returns the nodes hosting volumes in the selected namespaces
+func (s *NodeProxyStatsSource) Nodes(ctx context.Context) ([]string, error) {
+	return GetNodesToQuery(ctx, s.Clientset, s.NamespaceFilter)
+}
+
+// Collect queries the nodes concurrently
+func (s *NodeProxyStatsSource) Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+	return ProduceOutputRowsConcurrently(ctx, s.Clientset, s.ClaimIndex, s.NamespaceFilter, nodeNames, s.QueryOptions, outputRowPVCChan)
+}
+
+// FileStatsSource replays saved stats/summary responses
+type FileStatsSource struct {
+	NodeSummaries   []NodeSummary
+	ClaimIndex      *VolumeClaimIndex
+	NamespaceFilter *NamespaceFilter
+}
+
+// Nodes returns the nodes the responses were saved from
+func (s *FileStatsSource) Nodes(ctx context.Context) ([]string, error) {
+	var sliceOfNodeName []string
+	for _, nodeSummary := range s.NodeSummaries {
+		sliceOfNodeName = append(sliceOfNodeName, nodeSummary.NodeName)
+	}
+	return sliceOfNodeName, nil
+}
+
+// Collect parses the saved responses exactly like the responses of the nodes; a response that cannot be parsed fails
+// its node only
+func (s *FileStatsSource) Collect(ctx context.Context, nodeNames []string, outputRowPVCChan chan<- *OutputRowPVC) error {
+	defer close(outputRowPVCChan)
+
+	var failedNodes nodeErrorRecorder
+	for _, nodeName := range nodeNames {
+		for _, nodeSummary := range s.NodeSummaries {
+			if nodeSummary.NodeName != nodeName {
+				continue
+			}
+			sliceOfOutputRowPVC, err := GetOutputRowsFromStatsSummary(ctx, s.ClaimIndex, s.NamespaceFilter, nodeName, nodeSummary.Summary)
+			if err != nil {
+				failedNodes.record(nodeName, err)
+				continue
+			}
+			for _, outputRowPVC := range sliceOfOutputRowPVC {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case outputRowPVCChan <- outputRowPVC:
+				}
+			}
+		}
+	}
+	return failedNodes.result(len(nodeNames))
+}
+
+// statsCollection is everything a collection needs: the source of the stats and the claims the volumes are resolved
+// to; clientset is nil when no cluster is involved
+type statsCollection struct {
+	clientset       kubernetes.Interface
+	claimIndex      *VolumeClaimIndex
+	namespaceFilter *NamespaceFilter
+	source          StatsSource
+}
+
+// newStatsCollection sets up the collection from the source selected by the flags
+func (flags *flagpole) newStatsCollection(ctx context.Context) (*statsCollection, error) {
+	if err := flags.validateSource(); err != nil {
+		return nil, err
+	}
+	source, _ := flags.selectedSource()
+
+	if source == sourceFiles {
+		dump, err := flags.readDump()
+		if err != nil {
+			return nil, err
+		}
+		namespaceFilter, err := flags.namespaceFilter()
+		if err != nil {
+			return nil, err
+		}
+		claimIndex := NewStaticVolumeClaimIndex(dump.PVCs, dump.PVs)
+		return &statsCollection{
+			claimIndex:      claimIndex,
+			namespaceFilter: namespaceFilter,
+			source:          &FileStatsSource{NodeSummaries: dump.NodeSummaries, ClaimIndex: claimIndex, NamespaceFilter: namespaceFilter},
+		}, nil
+	}
+
+	clientset, err := flags.newClientset()
+	if err != nil {
+		return nil, err
+	}
+	namespaceFilter, err := flags.resolveNamespaceFilter(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	// shared by all node producers so PVCs and PVs are listed once instead of fetched per volume
+	claimIndex := NewVolumeClaimIndex(clientset, namespaceFilter.SingleNamespace())
+	if source == sourcePrometheus {
+		prometheusSource, err := NewPrometheusStatsSource(flags.prometheusURL, flags.prometheusNodeLabel, claimIndex, namespaceFilter)
+		if err != nil {
+			return nil, err
+		}
+		return &statsCollection{
+			clientset:       clientset,
+			claimIndex:      claimIndex,
+			namespaceFilter: namespaceFilter,
+			source:          prometheusSource,
+		}, nil
+	}
+	if source == sourceProbe {
+		return &statsCollection{
+			clientset:       clientset,
+			claimIndex:      claimIndex,
+			namespaceFilter: namespaceFilter,
+			source:          flags.newHostPathProbeStatsSource(clientset, claimIndex, namespaceFilter),
+		}, nil
+	}
+	if source == sourceExec {
+		execSource, err := flags.newExecStatsSource(clientset, claimIndex, namespaceFilter)
+		if err != nil {
+			return nil, err
+		}
+		return &statsCollection{
+			clientset:       clientset,
+			claimIndex:      claimIndex,
+			namespaceFilter: namespaceFilter,
+			source:          execSource,
+		}, nil
+	}
+	queryOptions, err := flags.withKubeletClient(ctx, clientset, flags.nodeQueryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &statsCollection{
+		clientset:       clientset,
+		claimIndex:      claimIndex,
+		namespaceFilter: namespaceFilter,
+		source: &NodeProxyStatsSource{
+			Clientset:       clientset,
+			ClaimIndex:      claimIndex,
+			NamespaceFilter: namespaceFilter,
+			QueryOptions:    queryOptions,
+		},
+	}, nil
+}
+
+// loadClaims lists the PVCs before any node is queried: every node resolves its volumes against them, so a failing
+// list, e.g. for lack of RBAC, is reported once instead of as the failure of every node. The prometheus source does
+// without the PVCs.
+func (collection *statsCollection) loadClaims(ctx context.Context) error {
+	if _, ok := collection.source.(*PrometheusStatsSource); ok {
+		return nil
+	}
+	return collection.claimIndex.load(ctx)
+}
+
+// allClaimsIndex returns an index of the PVCs of all namespaces, as needed to tell whether a PV is orphaned
+func (collection *statsCollection) allClaimsIndex() *VolumeClaimIndex {
+	if collection.clientset == nil {
+		return collection.claimIndex
+	}
+	return NewVolumeClaimIndex(collection.clientset, "")
+}
+
+// selectedSource returns the source chosen with --source or with one of its shorthands, --kubelet-direct for the
+// kubelet source and --probe-hostpath for the probe source
+func (flags *flagpole) selectedSource() (string, error) {
+	source, err := parseSource(flags.source, flags.isOffline())
+	if err != nil {
+		return "", errors.Wrap(err, "invalid source")
+	}
+	explicit := strings.TrimSpace(flags.source) != "" || flags.isOffline()
+	for _, shorthand := range []struct {
+		flag   string
+		set    bool
+		source string
+	}{
+		{flag: "kubelet-direct", set: flags.kubeletDirect, source: sourceKubelet},
+		{flag: "probe-hostpath", set: flags.probeHostPath, source: sourceProbe},
+	} {
+		if !shorthand.set {
+			continue
+		}
+		if explicit && source != shorthand.source {
+			return "", fmt.Errorf("%s cannot be combined with the %s source", shorthand.flag, source)
+		}
+		source, explicit = shorthand.source, true
+	}
+	return source, nil
+}
+
+// isKubeletDirect reports whether the kubelets are queried directly instead of through the API server's node proxy
+func (flags *flagpole) isKubeletDirect() bool {
+	source, err := flags.selectedSource()
+	return err == nil && source == sourceKubelet
+}
+
+// validateSource validates --source and its shorthands, the --prometheus-* and --probe-* flags, and rejects the
+// flags that need a cluster when replaying from files
+func (flags *flagpole) validateSource() error {
+	source, err := flags.selectedSource()
+	if err != nil {
+		return err
+	}
+	if err := flags.validateProbe(source); err != nil {
+		return err
+	}
+	if source == sourcePrometheus && flags.prometheusURL == "" {
+		return fmt.Errorf("the %s source needs prometheus-url", sourcePrometheus)
+	}
+	if source != sourcePrometheus && flags.prometheusURL != "" {
+		return fmt.Errorf("prometheus-url can only be used with the %s source", sourcePrometheus)
+	}
+	if source != sourcePrometheus && flags.prometheusNodeLabel != "" && flags.prometheusNodeLabel != defaultPrometheusNodeLabel {
+		return fmt.Errorf("prometheus-node-label can only be used with the %s source", sourcePrometheus)
+	}
+	if source == sourcePrometheus && !prometheusLabelNamePattern.MatchString(flags.prometheusNodeLabel) {
+		return fmt.Errorf("invalid prometheus-node-label %q", flags.prometheusNodeLabel)
+	}
+	if source != sourceFiles {
+		return nil
+	}
+	if 0 < len(flags.namespaceSelector) {
+		return fmt.Errorf("namespace-selector is not supported with from-file or from-dir")
+	}
+	if flags.needsOwners() {
+		return fmt.Errorf("owner columns and grouping are not supported with from-file or from-dir")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package df_pv
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseSource(t *testing.T) {
+	for _, tc := range []struct {
+		source  string
+		offline bool
+		want    string
+		wantErr string
+	}{
+		{source: "", want: sourceNodeProxy},
+		{source: "", offline: true, want: sourceFiles},
+		{source: " Proxy ", want: sourceNodeProxy},
+		{source: "files", wantErr: "needs from-file or from-dir"},
+		{source: "proxy", offline: true, wantErr: "can only be used with the files source"},
+		{source: "carrier-pigeon", wantErr: "unknown source"},
+	} {
+		got, err := parseSource(tc.source, tc.offline)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("parseSource(%q, %t) error = %v, want %q", tc.source, tc.offline, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("parseSource(%q, %t) = %q, %v, want %q", tc.source, tc.offline, got, err, tc.want)
+		}
+	}
+}
+
+func TestSelectedSourceAcceptsShorthands(t *testing.T) {
+	for _, tc := range []struct {
+		flags   flagpole
+		want    string
+		wantErr string
+	}{
+		{flags: flagpole{source: "kubelet"}, want: sourceKubelet},
+		{flags: flagpole{kubeletDirect: true}, want: sourceKubelet},
+		{flags: flagpole{source: "kubelet", kubeletDirect: true}, want: sourceKubelet},
+		{flags: flagpole{source: "probe"}, want: sourceProbe},
+		{flags: flagpole{probeHostPath: true}, want: sourceProbe},
+		{flags: flagpole{source: "proxy", kubeletDirect: true}, wantErr: "kubelet-direct cannot be combined with the proxy source"},
+		{flags: flagpole{fromDir: "testdata/dump", probeHostPath: true}, wantErr: "probe-hostpath cannot be combined with the files source"},
+		{flags: flagpole{kubeletDirect: true, probeHostPath: true}, wantErr: "probe-hostpath cannot be combined with the kubelet source"},
+	} {
+		got, err := tc.flags.selectedSource()
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%+v.selectedSource() error = %v, want %q", tc.flags, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%+v.selectedSource() = %q, %v, want %q", tc.flags, got, err, tc.want)
+		}
+	}
+	if direct := (&flagpole{source: "kubelet"}).nodeQueryOptions().Kubelet.Direct; !direct {
+		t.Fatal("the kubelet source does not query the kubelets directly")
+	}
+}
+
+func TestNodeProxyStatsSourceNodesWithFakeClientset(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}},
+		newPodWithPVC("team-a", "db-0", "node-1", "data-db-0"),
+		newPodWithPVC("team-b", "web-0", "node-3", "uploads"),
+	)
+
+	source := &NodeProxyStatsSource{Clientset: clientset}
+	nodeNames, err := source.Nodes(context.Background())
+	if err != nil || len(nodeNames) != 3 {
+		t.Fatalf("Nodes without a namespace selection = %v, %v, want every node", nodeNames, err)
+	}
+
+	namespaceFilter, err := NewNamespaceFilter("team-a", nil)
+	if err != nil {
+		t.Fatalf("NewNamespaceFilter returned unexpected error: %v", err)
+	}
+	source.NamespaceFilter = namespaceFilter
+	nodeNames, err = source.Nodes(context.Background())
+	if err != nil || len(nodeNames) != 1 || nodeNames[0] != "node-1" {
+		t.Fatalf("Nodes for team-a = %v, %v, want [node-1]", nodeNames, err)
+	}
+}
+
+func TestFileStatsSourceFailsBrokenNodesOnly(t *testing.T) {
+	dump, err := ReadDump("testdata/dump")
+	if err != nil {
+		t.Fatalf("ReadDump returned unexpected error: %v", err)
+	}
+	claimIndex := NewStaticVolumeClaimIndex(dump.PVCs, dump.PVs)
+	source := &FileStatsSource{
+		NodeSummaries: append(dump.NodeSummaries, NodeSummary{NodeName: "node-3", Summary: []byte(`{"pods": "not a list"}`)}),
+		ClaimIndex:    claimIndex,
+	}
+
+	nodeNames, err := source.Nodes(context.Background())
+	if err != nil || len(nodeNames) != 3 {
+		t.Fatalf("Nodes = %v, %v, want the 3 saved nodes", nodeNames, err)
+	}
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	collectErrChan := make(chan error, 1)
+	go func() {
+		collectErrChan <- source.Collect(context.Background(), nodeNames, outputRowPVCChan)
+	}()
+	var pvNames []string
+	for row := range outputRowPVCChan {
+		pvNames = append(pvNames, row.PVName)
+	}
+	sort.Strings(pvNames)
+	if len(pvNames) != 2 || pvNames[0] != "pvc-db" || pvNames[1] != "pvc-uploads" {
+		t.Fatalf("collected PVs = %v, want [pvc-db pvc-uploads]", pvNames)
+	}
+
+	collectErr := <-collectErrChan
+	var nodeCollectionErr *NodeCollectionError
+	if !errors.As(collectErr, &nodeCollectionErr) || !nodeCollectionErr.IsPartial() || nodeCollectionErr.FailedNodes[0].NodeName != "node-3" || nodeCollectionErr.FailedNodes[0].Class != nodeErrorClassInvalidResponse {
+		t.Fatalf("expected node-3 to fail with an invalid response, got %v", collectErr)
+	}
+}
@@ -0,0 +1,67 @@
+package df_pv
+
+import (
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/text"
+)
+
+// Threshold holds the usage percentages at which a volume is considered a warning (yellow) or critical (red)
+type Threshold struct {
+	Warn     float64
+	Critical float64
+}
+
+// Thresholds holds the thresholds for byte usage and inode usage
+type Thresholds struct {
+	Bytes  Threshold
+	Inodes Threshold
+}
+
+// DefaultThresholds are used when no thresholds are configured
+var DefaultThresholds = Thresholds{
+	Bytes:  Threshold{Warn: 25, Critical: 75},
+	Inodes: Threshold{Warn: 25, Critical: 75},
+}
+
+// NewThresholds validates and builds thresholds from the byte and inode warn/critical percentages
+func NewThresholds(warn float64, critical float64, inodeWarn float64, inodeCritical float64) (Thresholds, error) {
+	thresholds := Thresholds{
+		Bytes:  Threshold{Warn: warn, Critical: critical},
+		Inodes: Threshold{Warn: inodeWarn, Critical: inodeCritical},
+	}
+	if err := thresholds.Bytes.validate(); err != nil {
+		return Thresholds{}, err
+	}
+	if err := thresholds.Inodes.validate(); err != nil {
+		return Thresholds{}, fmt.Errorf("inode %v", err)
+	}
+	return thresholds, nil
+}
+
+func (t Threshold) validate() error {
+	if t.Warn < 0 || t.Warn > 100 {
+		return fmt.Errorf("warn threshold must be between 0 and 100, got %v", t.Warn)
+	}
+	if t.Critical < 0 || t.Critical > 100 {
+		return fmt.Errorf("critical threshold must be between 0 and 100, got %v", t.Critical)
+	}
+	if t.Warn > t.Critical {
+		return fmt.Errorf("warn threshold (%v) cannot be greater than critical threshold (%v)", t.Warn, t.Critical)
+	}
+	return nil
+}
+
+// Color gives a color based on percentage: red above critical, green below warn, yellow otherwise; percentages that
+// cannot be computed get no color (text.Reset)
+func (t Threshold) Color(percentageUsed float64) text.Color {
+	if isUnknownValue(percentageUsed) {
+		return text.Reset
+	} else if percentageUsed > t.Critical {
+		return text.FgRed
+	} else if percentageUsed < t.Warn {
+		return text.FgGreen
+	} else {
+		return text.FgYellow
+	}
+}
@@ -0,0 +1,73 @@
+package df_pv
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jedib0t/go-pretty/text"
+)
+
+func TestThresholdColor(t *testing.T) {
+	tests := []struct {
+		name           string
+		threshold      Threshold
+		percentageUsed float64
+		want           text.Color
+	}{
+		{name: "default below warn is green", threshold: DefaultThresholds.Bytes, percentageUsed: 24.9, want: text.FgGreen},
+		{name: "default at warn is yellow", threshold: DefaultThresholds.Bytes, percentageUsed: 25, want: text.FgYellow},
+		{name: "default at critical is yellow", threshold: DefaultThresholds.Bytes, percentageUsed: 75, want: text.FgYellow},
+		{name: "default above critical is red", threshold: DefaultThresholds.Bytes, percentageUsed: 75.1, want: text.FgRed},
+		{name: "custom normal usage is green", threshold: Threshold{Warn: 80, Critical: 90}, percentageUsed: 75, want: text.FgGreen},
+		{name: "custom warn is yellow", threshold: Threshold{Warn: 80, Critical: 90}, percentageUsed: 85, want: text.FgYellow},
+		{name: "custom critical is red", threshold: Threshold{Warn: 80, Critical: 90}, percentageUsed: 95, want: text.FgRed},
+		{name: "unknown usage has no color", threshold: DefaultThresholds.Bytes, percentageUsed: math.NaN(), want: text.Reset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.threshold.Color(tt.percentageUsed); got != tt.want {
+				t.Fatalf("Threshold%+v.Color(%v) = %v, want %v", tt.threshold, tt.percentageUsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewThresholdsRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		warn, critical, inodeWarn, inodeCritical float64
+		errorMatch                               string
+	}{
+		{warn: -1, critical: 75, inodeWarn: 25, inodeCritical: 75, errorMatch: "warn threshold must be between 0 and 100"},
+		{warn: 25, critical: 101, inodeWarn: 25, inodeCritical: 75, errorMatch: "critical threshold must be between 0 and 100"},
+		{warn: 90, critical: 80, inodeWarn: 25, inodeCritical: 75, errorMatch: "cannot be greater than critical threshold"},
+		{warn: 25, critical: 75, inodeWarn: 90, inodeCritical: 80, errorMatch: "inode warn threshold (90) cannot be greater"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewThresholds(tt.warn, tt.critical, tt.inodeWarn, tt.inodeCritical)
+		if err == nil || !strings.Contains(err.Error(), tt.errorMatch) {
+			t.Fatalf("NewThresholds(%v, %v, %v, %v) error = %v, want substring %q", tt.warn, tt.critical, tt.inodeWarn, tt.inodeCritical, err, tt.errorMatch)
+		}
+	}
+}
+
+func TestFilterOutputRowsUsesSeparateInodeThresholds(t *testing.T) {
+	rows := []*OutputRowPVC{
+		{PVCName: "bytes-85", PercentageUsed: 85, PercentageIUsed: 1},
+		{PVCName: "inodes-85", PercentageUsed: 1, PercentageIUsed: 85},
+	}
+	thresholds, err := NewThresholds(80, 90, 50, 80)
+	if err != nil {
+		t.Fatalf("NewThresholds returned unexpected error: %v", err)
+	}
+	filter, err := NewRowFilter("red", 0, 100, thresholds)
+	if err != nil {
+		t.Fatalf("NewRowFilter returned unexpected error: %v", err)
+	}
+	got := pvcNames(FilterOutputRows(rows, filter))
+	if len(got) != 1 || got[0] != "inodes-85" {
+		t.Fatalf("FilterOutputRows = %v, want [inodes-85]", got)
+	}
+}
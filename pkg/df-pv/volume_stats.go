@@ -0,0 +1,155 @@
+package df_pv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels of the kubelet_volume_stats_* series
+const (
+	volumeStatsNamespaceLabel = "namespace"
+	volumeStatsPVCLabel       = "persistentvolumeclaim"
+)
+
+// volumeStatsSeriesPrefix is shared by the names of all the kubelet volume stats series
+const volumeStatsSeriesPrefix = "kubelet_volume_stats_"
+
+// kubelet volume stats series, along with where each one goes in a Volume
+var volumeStatsSeries = []struct {
+	name string
+	set  func(vol *Volume, value float64)
+}{
+	{"kubelet_volume_stats_capacity_bytes", func(vol *Volume, value float64) { vol.CapacityBytes = int64(value) }},
+	{"kubelet_volume_stats_used_bytes", func(vol *Volume, value float64) { vol.UsedBytes = int64(value) }},
+	{"kubelet_volume_stats_available_bytes", func(vol *Volume, value float64) { vol.AvailableBytes = int64(value) }},
+	{"kubelet_volume_stats_inodes", func(vol *Volume, value float64) { vol.Inodes = uint64(value) }},
+	{"kubelet_volume_stats_inodes_used", func(vol *Volume, value float64) { vol.InodesUsed = uint64(value) }},
+	{"kubelet_volume_stats_inodes_free", func(vol *Volume, value float64) { vol.InodesFree = uint64(value) }},
+}
+
+// volumeStatsSamples gathers the samples of the kubelet volume stats series into a Volume per PVC and node
+type volumeStatsSamples struct {
+	volumes map[string]*volumeOnNode
+}
+
+type volumeOnNode struct {
+	nodeName string
+	vol      *Volume
+}
+
+// add records the value of the named series for a PVC on a node; samples of other series are ignored
+func (samples *volumeStatsSamples) add(seriesName string, namespace string, pvcName string, nodeName string, value float64) {
+	for _, series := range volumeStatsSeries {
+		if series.name != seriesName {
+			continue
+		}
+		if samples.volumes == nil {
+			samples.volumes = make(map[string]*volumeOnNode)
+		}
+		key := pvcKey(namespace, pvcName) + "@" + nodeName
+		if _, ok := samples.volumes[key]; !ok {
+			vol := &Volume{}
+			vol.PvcRef.PvcNamespace = namespace
+			vol.PvcRef.PvcName = pvcName
+			samples.volumes[key] = &volumeOnNode{nodeName: nodeName, vol: vol}
+		}
+		series.set(samples.volumes[key].vol, value)
+	}
+}
+
+// outputRows turns the volumes into rows, enriched like the volumes of a stats/summary response; the series do not
+// tell which pod mounts a volume
+func (samples *volumeStatsSamples) outputRows(ctx context.Context, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter) ([]*OutputRowPVC, error) {
+	var keys []string
+	for key := range samples.volumes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sliceOfOutputRowPVC []*OutputRowPVC
+	for _, key := range keys {
+		volume := samples.volumes[key]
+		pod := &Pod{}
+		pod.PodRef.Namespace = volume.vol.PvcRef.PvcNamespace
+		outputRowPVC, err := GetOutputRowPVCFromPodAndVolume(ctx, claimIndex, pod, volume.vol, namespaceFilter)
+		if isUnresolvedClaimError(err) {
+			// series may outlive their PVC, e.g. for the lookback period of a Prometheus query, or precede its binding
+			log.Warnf("skipping the stats of PVC '%s': %v", key, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if outputRowPVC == nil {
+			continue
+		}
+		outputRowPVC.NodeName = volume.nodeName
+		sliceOfOutputRowPVC = append(sliceOfOutputRowPVC, outputRowPVC)
+	}
+	return sliceOfOutputRowPVC, nil
+}
+
+// GetOutputRowsFromKubeletMetrics gets the output rows from the kubelet_volume_stats_* series of the /metrics
+// response of a node
+func GetOutputRowsFromKubeletMetrics(ctx context.Context, claimIndex *VolumeClaimIndex, namespaceFilter *NamespaceFilter, nodeName string, metrics []byte) ([]*OutputRowPVC, error) {
+	// only the volume stats are parsed, so that nothing else the kubelet exposes can fail the node
+	var volumeStatsLines bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if isVolumeStatsLine(scanner.Text()) {
+			volumeStatsLines.WriteString(scanner.Text())
+			volumeStatsLines.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the metrics response")
+	}
+
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	metricFamilies, err := parser.TextToMetricFamilies(&volumeStatsLines)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the metrics response")
+	}
+	var samples volumeStatsSamples
+	for name, metricFamily := range metricFamilies {
+		for _, metric := range metricFamily.GetMetric() {
+			var namespace, pvcName string
+			for _, label := range metric.GetLabel() {
+				switch label.GetName() {
+				case volumeStatsNamespaceLabel:
+					namespace = label.GetValue()
+				case volumeStatsPVCLabel:
+					pvcName = label.GetValue()
+				}
+			}
+			if pvcName == "" {
+				continue
+			}
+			value := metric.GetGauge().GetValue()
+			if metric.GetGauge() == nil {
+				value = metric.GetUntyped().GetValue()
+			}
+			samples.add(name, namespace, pvcName, nodeName, value)
+		}
+	}
+	return samples.outputRows(ctx, claimIndex, namespaceFilter)
+}
+
+// isVolumeStatsLine reports whether a line of the text exposition format is a sample, HELP or TYPE line of a volume
+// stats series
+func isVolumeStatsLine(line string) bool {
+	for _, prefix := range []string{"", "# HELP ", "# TYPE "} {
+		if strings.HasPrefix(line, prefix+volumeStatsSeriesPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package df_pv
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func kubeletVolumeStatsMetrics(namespace string, pvcName string) string {
+	labels := `{namespace="` + namespace + `",persistentvolumeclaim="` + pvcName + `"}`
+	return `# HELP kubelet_running_pods [ALPHA] Number of pods that have a running pod sandbox
+# TYPE kubelet_running_pods gauge
+kubelet_running_pods 12
+# HELP kubelet_volume_stats_available_bytes [ALPHA] Number of available bytes in the volume
+# TYPE kubelet_volume_stats_available_bytes gauge
+kubelet_volume_stats_available_bytes` + labels + ` 7.5e+08
+# HELP kubelet_volume_stats_capacity_bytes [ALPHA] Capacity in bytes of the volume
+# TYPE kubelet_volume_stats_capacity_bytes gauge
+kubelet_volume_stats_capacity_bytes` + labels + ` 1e+09
+# HELP kubelet_volume_stats_health_status_abnormal [ALPHA] Abnormal volume health status
+# TYPE kubelet_volume_stats_health_status_abnormal gauge
+kubelet_volume_stats_health_status_abnormal` + labels + ` 0
+# HELP kubelet_volume_stats_inodes [ALPHA] Maximum number of inodes in the volume
+# TYPE kubelet_volume_stats_inodes gauge
+kubelet_volume_stats_inodes` + labels + ` 1000
+# HELP kubelet_volume_stats_inodes_free [ALPHA] Number of free inodes in the volume
+# TYPE kubelet_volume_stats_inodes_free gauge
+kubelet_volume_stats_inodes_free` + labels + ` 900
+# HELP kubelet_volume_stats_inodes_used [ALPHA] Number of used inodes in the volume
+# TYPE kubelet_volume_stats_inodes_used gauge
+kubelet_volume_stats_inodes_used` + labels + ` 100
+# HELP kubelet_volume_stats_used_bytes [ALPHA] Number of used bytes in the volume
+# TYPE kubelet_volume_stats_used_bytes gauge
+kubelet_volume_stats_used_bytes` + labels + ` 2.5e+08
+# HELP rest_client_requests_total [ALPHA] Number of HTTP requests, partitioned by status code, method, and host.
+# TYPE rest_client_requests_total counter
+rest_client_requests_total{code="200",host="[::1]:6443",method="GET"} 42
+`
+}
+
+func TestGetOutputRowsFromKubeletMetrics(t *testing.T) {
+	claimIndex := NewStaticVolumeClaimIndex(
+		&corev1.PersistentVolumeClaimList{Items: []corev1.PersistentVolumeClaim{newBoundPVC("team-a", "data-db-0", "pvc-db")}},
+		&corev1.PersistentVolumeList{},
+	)
+	metrics := kubeletVolumeStatsMetrics("team-a", "data-db-0") + "this line is not in the exposition format\n"
+
+	rows, err := GetOutputRowsFromKubeletMetrics(context.Background(), claimIndex, nil, "node-1", []byte(metrics))
+	if err != nil {
+		t.Fatalf("GetOutputRowsFromKubeletMetrics returned unexpected error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected a single row, got %d", len(rows))
+	}
+	row := rows[0]
+	if row.Namespace != "team-a" || row.PVCName != "data-db-0" || row.PVName != "pvc-db" || row.NodeName != "node-1" {
+		t.Fatalf("unexpected row: %+v", row)
+	}
+	if row.CapacityBytes.Value() != 1000000000 || row.UsedBytes.Value() != 250000000 || row.AvailableBytes.Value() != 750000000 || row.PercentageUsed != 25 {
+		t.Fatalf("unexpected bytes: %s used of %s, %s available", row.UsedBytes, row.CapacityBytes, row.AvailableBytes)
+	}
+	if row.Inodes != 1000 || row.InodesUsed != 100 || row.InodesFree != 900 || row.PercentageIUsed != 10 {
+		t.Fatalf("unexpected inodes: %d used of %d, %d free", row.InodesUsed, row.Inodes, row.InodesFree)
+	}
+
+	if _, err := GetOutputRowsFromKubeletMetrics(context.Background(), claimIndex, nil, "node-1", []byte("kubelet_volume_stats_used_bytes{persistentvolumeclaim=\"x\" 1\n")); err == nil {
+		t.Fatalf("expected a malformed volume stats series to fail")
+	}
+}
+
+func TestGetOutputRowsFromKubeletMetricsSkipsUnresolvedClaims(t *testing.T) {
+	claimIndex := NewStaticVolumeClaimIndex(
+		&corev1.PersistentVolumeClaimList{Items: []corev1.PersistentVolumeClaim{newBoundPVC("ns", "bound", "pv-bound"), newBoundPVC("ns", "pending", "")}},
+		&corev1.PersistentVolumeList{},
+	)
+	var metrics strings.Builder
+	for _, pvcName := range []string{"bound", "pending", "deleted"} {
+		metrics.WriteString(`kubelet_volume_stats_capacity_bytes{namespace="ns",persistentvolumeclaim="` + pvcName + "\"} 100\n")
+		metrics.WriteString(`kubelet_volume_stats_used_bytes{namespace="ns",persistentvolumeclaim="` + pvcName + "\"} 10\n")
+	}
+
+	rows, err := GetOutputRowsFromKubeletMetrics(context.Background(), claimIndex, nil, "node-1", []byte(metrics.String()))
+	if err != nil {
+		t.Fatalf("GetOutputRowsFromKubeletMetrics returned unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].PVCName != "bound" || rows[0].PVName != "pv-bound" {
+		t.Fatalf("expected only the row of the bound PVC, got %+v", rows)
+	}
+}
+
+func TestProduceOutputRowsFallsBackToKubeletMetrics(t *testing.T) {
+	summary := `{"pods":[{"podRef":{"name":"db-0","namespace":"team-a"},"volume":[{"name":"data","capacityBytes":100,"usedBytes":10,"availableBytes":90,"pvcRef":{"name":"data-db-0","namespace":"team-a"}}]}]}`
+	clientset := newFakeClusterClientset(t, &fakeCluster{
+		nodeSummaries: map[string]string{"node-1": summary, "node-2": summary},
+		nodeMetrics: map[string]string{
+			"node-1": kubeletVolumeStatsMetrics("team-b", "ignored"),
+			"node-2": kubeletVolumeStatsMetrics("team-b", "uploads"),
+			"node-3": kubeletVolumeStatsMetrics("team-b", "logs"),
+		},
+		summaryStatusCode: map[string]int{"node-2": http.StatusForbidden, "node-5": http.StatusForbidden},
+		nodeStatusCode:    map[string]int{"node-4": http.StatusForbidden},
+		pvcs: []corev1.PersistentVolumeClaim{
+			newBoundPVC("team-a", "data-db-0", "pvc-db"),
+			newBoundPVC("team-b", "uploads", "pvc-uploads"),
+			newBoundPVC("team-b", "logs", "pvc-logs"),
+		},
+	})
+
+	outputRowPVCChan := make(chan *OutputRowPVC)
+	result := make(chan error, 1)
+	go func() {
+		result <- ProduceOutputRowsConcurrently(context.Background(), clientset, NewVolumeClaimIndex(clientset, ""), nil, []string{"node-1", "node-2", "node-3", "node-4", "node-5"}, NodeQueryOptions{}, outputRowPVCChan)
+	}()
+	var collected []string
+	for row := range outputRowPVCChan {
+		collected = append(collected, row.NodeName+":"+row.PVName)
+	}
+	sort.Strings(collected)
+
+	// node-1 serves its summary, node-2 forbids it and node-3 does not serve it, node-4 fails altogether and node-5
+	// forbids its summary but does not serve its metrics
+	if want := "node-1:pvc-db,node-2:pvc-uploads,node-3:pvc-logs"; strings.Join(collected, ",") != want {
+		t.Fatalf("collected %v, want %s", collected, want)
+	}
+	var collectionErr *NodeCollectionError
+	if err := <-result; !errors.As(err, &collectionErr) || len(collectionErr.FailedNodes) != 2 {
+		t.Fatalf("expected node-4 and node-5 only to fail, got %v", err)
+	}
+	if failed := collectionErr.FailedNodes[0]; failed.NodeName != "node-4" || failed.Class != nodeErrorClassForbidden || !strings.Contains(failed.Message, "metrics") {
+		t.Fatalf("unexpected failed node: %+v", failed)
+	}
+	if failed := collectionErr.FailedNodes[1]; failed.NodeName != "node-5" || failed.Class != nodeErrorClassNotFound || !strings.Contains(failed.Message, "test summary error") {
+		t.Fatalf("expected node-5 to be classified by its metrics failure, got %+v", failed)
+	}
+}
@@ -0,0 +1,170 @@
+package df_pv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// clearScreen moves the cursor home and clears the terminal so the table is redrawn in place
+const clearScreen = "\033[H\033[2J"
+
+var watchColumnOrder = []string{"delta", "rate"}
+
+// usageSnapshot remembers the used bytes of every volume at a point in time
+type usageSnapshot struct {
+	collectedAt time.Time
+	usedBytes   map[string]int64
+}
+
+// usageSnapshotKey identifies the volume of a row by its claim, so that its delta survives its pods being
+// rescheduled or replaced, and does not depend on whether the rows are per mount
+func usageSnapshotKey(row *OutputRowPVC) string {
+	return pvcKey(row.Namespace, row.PVCName)
+}
+
+func newUsageSnapshot(sliceOfOutputRowPVC []*OutputRowPVC, collectedAt time.Time) *usageSnapshot {
+	snapshot := &usageSnapshot{
+		collectedAt: collectedAt,
+		usedBytes:   make(map[string]int64, len(sliceOfOutputRowPVC)),
+	}
+	for _, row := range sliceOfOutputRowPVC {
+		if row.UsageUnknown {
+			continue
+		}
+		snapshot.usedBytes[usageSnapshotKey(row)] = quantityValue(row.UsedBytes)
+	}
+	return snapshot
+}
+
+// ApplyUsageDeltas sets the delta and rate of every row that also appeared in the previous snapshot
+func ApplyUsageDeltas(sliceOfOutputRowPVC []*OutputRowPVC, previous *usageSnapshot, collectedAt time.Time) {
+	if previous == nil {
+		return
+	}
+	elapsedSeconds := collectedAt.Sub(previous.collectedAt).Seconds()
+	for _, row := range sliceOfOutputRowPVC {
+		previousUsedBytes, ok := previous.usedBytes[usageSnapshotKey(row)]
+		if !ok {
+			continue
+		}
+		delta := quantityValue(row.UsedBytes) - previousUsedBytes
+		row.UsedBytesDelta = &delta
+		if elapsedSeconds > 0 {
+			rate := float64(delta) / elapsedSeconds
+			row.UsedBytesPerSecond = &rate
+		}
+	}
+}
+
+// FormatUsedBytesDelta formats a delta as a signed IEC value, or "-" when unknown
+func FormatUsedBytesDelta(delta *int64) string {
+	if delta == nil {
+		return "-"
+	}
+	return formatSignedIEC(*delta)
+}
+
+// FormatUsedBytesPerSecond formats a rate as a signed IEC value per second, or "-" when unknown
+func FormatUsedBytesPerSecond(rate *float64) string {
+	if rate == nil {
+		return "-"
+	}
+	return formatSignedIEC(int64(*rate)) + "/s"
+}
+
+func formatSignedIEC(bytes int64) string {
+	switch {
+	case bytes > 0:
+		return "+" + ConvertQuantityValueToHumanReadableIECString(resource.NewQuantity(bytes, resource.BinarySI))
+	case bytes < 0:
+		return "-" + ConvertQuantityValueToHumanReadableIECString(resource.NewQuantity(-bytes, resource.BinarySI))
+	default:
+		return "0"
+	}
+}
+
+// runWatch re-runs collection every interval until interrupted, redrawing in place on a terminal and
+// appending timestamped blocks otherwise; failed nodes are listed after each refresh so that the redraw does not
+// wipe them, and the exit code is the one of the last refresh
+func runWatch(flags *flagpole, opts *rootCommandOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	interactive := term.IsTerminal(int(os.Stdout.Fd()))
+	ticker := time.NewTicker(flags.interval)
+	defer ticker.Stop()
+
+	var previous *usageSnapshot
+	var lastErr error
+	for {
+		collectedAt := time.Now()
+		sliceOfOutputRowPVC, nodeCollectionErr, err := collectOutputRows(ctx, flags, opts)
+		if ctx.Err() != nil {
+			return lastErr
+		}
+		if err != nil {
+			if reportErr := reportNodeErrors(nodeCollectionErr); reportErr != nil {
+				return reportErr
+			}
+			log.Errorf("unable to refresh volume usage: %v", err)
+			lastErr = &ExitCodeError{Code: exitCodeError, Err: err}
+		} else {
+			ApplyUsageDeltas(sliceOfOutputRowPVC, previous, collectedAt)
+			previous = newUsageSnapshot(sliceOfOutputRowPVC, collectedAt)
+
+			if interactive {
+				fmt.Print(clearScreen)
+				fmt.Println(watchHeader(flags.interval, collectedAt, nodeCollectionErr))
+			} else {
+				writeWatchSeparator(os.Stdout, os.Stderr, opts.outputFormat, collectedAt)
+			}
+			if err := printOutputRows(flags, opts, sliceOfOutputRowPVC, nodeCollectionErr, collectedAt); err != nil {
+				return err
+			}
+			if err := reportNodeErrors(nodeCollectionErr); err != nil {
+				return err
+			}
+			lastErr = partialResultsError(nodeCollectionErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return lastErr
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchHeader is the first line of every redraw on a terminal, saying when a refresh is partial
+func watchHeader(interval time.Duration, collectedAt time.Time, nodeCollectionErr *NodeCollectionError) string {
+	header := fmt.Sprintf("Every %s: kubectl df-pv    %s", interval, collectedAt.Format(time.RFC1123))
+	if nodeCollectionErr != nil {
+		header += fmt.Sprintf("    partial: %d of %d nodes failed", len(nodeCollectionErr.FailedNodes), nodeCollectionErr.TotalNodes)
+	}
+	return header
+}
+
+// writeWatchSeparator starts a refresh appended to a pipe: tables get a timestamp line, delimited output gets it on
+// stderr, and structured output carries its own timestamp; json documents simply follow each other while yaml ones
+// are separated by "---", so that the output stays parseable
+func writeWatchSeparator(stdout io.Writer, stderr io.Writer, outputFormat string, collectedAt time.Time) {
+	separator := fmt.Sprintf("=== %s ===\n", collectedAt.Format(time.RFC3339))
+	switch outputFormat {
+	case outputFormatJSON:
+	case outputFormatYAML:
+		fmt.Fprintln(stdout, "---")
+	case outputFormatCSV, outputFormatTSV:
+		fmt.Fprint(stderr, separator)
+	default:
+		fmt.Fprint(stdout, separator)
+	}
+}
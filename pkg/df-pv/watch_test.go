@@ -0,0 +1,113 @@
+package df_pv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyUsageDeltas(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous := newUsageSnapshot([]*OutputRowPVC{
+		newTestRow("ns", "growing", 1<<30, 1<<20),
+		newTestRow("ns", "shrinking", 1<<30, 3<<20),
+	}, start)
+
+	rows := []*OutputRowPVC{
+		newTestRow("ns", "growing", 1<<30, 11<<20),
+		newTestRow("ns", "shrinking", 1<<30, 1<<20),
+		newTestRow("ns", "new", 1<<30, 1<<20),
+	}
+	ApplyUsageDeltas(rows, previous, start.Add(10*time.Second))
+
+	tests := []struct {
+		row       *OutputRowPVC
+		wantDelta string
+		wantRate  string
+	}{
+		{row: rows[0], wantDelta: "+10Mi", wantRate: "+1Mi/s"},
+		{row: rows[1], wantDelta: "-2Mi", wantRate: "-204.8Ki/s"},
+		{row: rows[2], wantDelta: "-", wantRate: "-"},
+	}
+	for _, tt := range tests {
+		if got := allColumns["delta"].value(tt.row); got != tt.wantDelta {
+			t.Errorf("delta for %s = %v, want %s", tt.row.PVCName, got, tt.wantDelta)
+		}
+		if got := allColumns["rate"].value(tt.row); got != tt.wantRate {
+			t.Errorf("rate for %s = %v, want %s", tt.row.PVCName, got, tt.wantRate)
+		}
+	}
+	if raw := allColumns["delta"].raw(rows[0]); raw != "10485760" {
+		t.Errorf("raw delta = %q, want 10485760", raw)
+	}
+}
+
+func TestApplyUsageDeltasFollowsVolumesAcrossPods(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous := newUsageSnapshot([]*OutputRowPVC{withConsumer(newTestRow("ns", "data", 1<<30, 1<<20), "db-0", "node-1")}, start)
+
+	// the pod was replaced by one on another node
+	rows := []*OutputRowPVC{withConsumer(newTestRow("ns", "data", 1<<30, 2<<20), "db-1", "node-2")}
+	ApplyUsageDeltas(rows, previous, start.Add(time.Second))
+	if got := FormatUsedBytesDelta(rows[0].UsedBytesDelta); got != "+1Mi" {
+		t.Fatalf("delta of the volume after its pod moved = %s, want +1Mi", got)
+	}
+}
+
+func TestApplyUsageDeltasWithoutPreviousSnapshotLeavesRowsUntouched(t *testing.T) {
+	rows := []*OutputRowPVC{newTestRow("ns", "pvc", 1<<30, 1)}
+	ApplyUsageDeltas(rows, nil, time.Now())
+	if rows[0].UsedBytesDelta != nil || rows[0].UsedBytesPerSecond != nil {
+		t.Fatalf("expected no delta without a previous snapshot, got %+v", rows[0])
+	}
+}
+
+func TestFlagpoleParseForWatch(t *testing.T) {
+	flags := &flagpole{watch: true, interval: time.Second, maxUsed: 100, warnThreshold: 25, criticalThreshold: 75, inodeWarnThreshold: 25, inodeCriticalThreshold: 75}
+	opts, err := flags.parse()
+	if err != nil {
+		t.Fatalf("parse returned unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(opts.columns, ",%used,delta,rate") {
+		t.Fatalf("watch columns = %q, want default columns followed by delta and rate", opts.columns)
+	}
+
+	flags.interval = 0
+	if _, err := flags.parse(); err == nil || !strings.Contains(err.Error(), "interval must be positive") {
+		t.Fatalf("parse error = %v, want interval error", err)
+	}
+}
+
+func TestWatchHeaderReportsPartialRefresh(t *testing.T) {
+	collectedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := watchHeader(5*time.Second, collectedAt, nil); strings.Contains(got, "partial") {
+		t.Fatalf("watchHeader of a complete refresh = %q, want no partial notice", got)
+	}
+	nodeCollectionErr := &NodeCollectionError{FailedNodes: []*NodeError{{NodeName: "node-a"}}, TotalNodes: 3}
+	if got := watchHeader(5*time.Second, collectedAt, nodeCollectionErr); !strings.HasSuffix(got, "partial: 1 of 3 nodes failed") {
+		t.Fatalf("watchHeader of a partial refresh = %q, want the failed nodes count", got)
+	}
+}
+
+func TestWriteWatchSeparatorKeepsStructuredOutputParseable(t *testing.T) {
+	collectedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		outputFormat string
+		wantStdout   string
+		wantStderr   string
+	}{
+		{outputFormat: outputFormatTable, wantStdout: "=== 2020-01-02T03:04:05Z ===\n"},
+		{outputFormat: outputFormatCSV, wantStderr: "=== 2020-01-02T03:04:05Z ===\n"},
+		{outputFormat: outputFormatJSON},
+		{outputFormat: outputFormatYAML, wantStdout: "---\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		writeWatchSeparator(&stdout, &stderr, tt.outputFormat, collectedAt)
+		if stdout.String() != tt.wantStdout || stderr.String() != tt.wantStderr {
+			t.Fatalf("writeWatchSeparator(%s) wrote %q to stdout and %q to stderr, want %q and %q", tt.outputFormat, stdout.String(), stderr.String(), tt.wantStdout, tt.wantStderr)
+		}
+	}
+}